@@ -0,0 +1,52 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "strconv"
+
+// allAgesLabels maps locales to the translations of "All ages". It is
+// generated during setup.
+var allAgesLabels map[string]string
+
+// MinAge returns the minimum age of the event's audience, zero meaning
+// all ages. It is display-only metadata and not enforced.
+func (e eventCtx) MinAge() int {
+	age, _ := getCount(e.Node, "events.MinAge")
+	return age
+}
+
+// HasMinAge checks if the age suitability of the event is given.
+func (e eventCtx) HasMinAge() bool {
+	_, ok := getCount(e.Node, "events.MinAge")
+	return ok
+}
+
+// MinAgeLabel returns the age suitability of the event for the given
+// locale, e.g. "16+", or the translation of "All ages". It is empty if
+// the suitability is not given.
+func (e eventCtx) MinAgeLabel(locale string) string {
+	if !e.HasMinAge() {
+		return ""
+	}
+	if age := e.MinAge(); age > 0 {
+		return strconv.Itoa(age) + "+"
+	}
+	if label, ok := allAgesLabels[locale]; ok && label != "" {
+		return label
+	}
+	return "All ages"
+}
@@ -0,0 +1,107 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// atomLink is the link of an Atom feed or entry.
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// atomEntry is an entry of an Atom feed.
+type atomEntry struct {
+	Id        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Summary   string   `xml:"summary,omitempty"`
+	Link      atomLink `xml:"link"`
+}
+
+// atomFeed is an Atom 1.0 feed.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// eventLink returns the absolute URL of the given event's page, which is
+// its external URL if any. Occurrences of recurring events link to their
+// base event showing the occurrence, see Link.
+func eventLink(site string, event eventCtx) string {
+	if external := event.ExternalURL(); external != "" {
+		return external
+	}
+	return siteURL(site, event.Link())
+}
+
+// renderAtom serializes the given events to an Atom feed of the list
+// node.
+func renderAtom(site string, list *service.Node,
+	events ...[]eventCtx) ([]byte, error) {
+	listURL := siteURL(site, list.Path+"/")
+	feed := atomFeed{
+		Id:    listURL,
+		Title: getText(list, "core.Title"),
+		Links: []atomLink{
+			{Href: listURL},
+			{Rel: "self", Href: listURL + "?format=atom"},
+		},
+	}
+	var updated time.Time
+	for _, group := range events {
+		for _, event := range group {
+			start := event.Start()
+			if start.After(updated) {
+				updated = start
+			}
+			// Occurrences of recurring events share the event's URL.
+			id := siteURL(site, event.Path+"/")
+			if getText(event.Node, "events.Recurrence") != "" {
+				id += "#" + start.UTC().Format(icalTimeFormat)
+			}
+			feed.Entries = append(feed.Entries, atomEntry{
+				Id:        id,
+				Title:     getText(event.Node, "core.Title"),
+				Published: start.Format(time.RFC3339),
+				Updated:   start.Format(time.RFC3339),
+				Summary:   stripHTML(getText(event.Node, "core.Body")),
+				Link:      atomLink{Href: eventLink(site, event)},
+			})
+		}
+	}
+	if updated.IsZero() {
+		updated = list.Changed
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode feed: %v", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,66 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestRenderAtomOccurrences(t *testing.T) {
+	rule := service.TextField("FREQ=WEEKLY;COUNT=2")
+	start := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	event := &service.Node{Path: "/events/foo",
+		Fields: map[string]service.Field{
+			"events.StartTime":  &service.DateTimeField{start},
+			"events.Recurrence": &rule,
+		}}
+	var occurrences []eventCtx
+	for _, day := range []int{0, 7} {
+		occurrences = append(occurrences, eventCtx{
+			Node:     occurrence(event, start.AddDate(0, 0, day)),
+			location: time.UTC})
+	}
+	out, err := renderAtom("example.com", &service.Node{Path: "/events"},
+		occurrences)
+	if err != nil {
+		t.Fatalf("renderAtom() failed: %v", err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("Could not parse feed: %v", err)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("renderAtom() returned %d entries", len(feed.Entries))
+	}
+	links := []string{
+		"http://example.com/events/foo/?occurrence=2015-03-01",
+		"http://example.com/events/foo/?occurrence=2015-03-08",
+	}
+	for i, entry := range feed.Entries {
+		if entry.Link.Href != links[i] {
+			t.Errorf("Entry %d links to %q, should link to %q", i,
+				entry.Link.Href, links[i])
+		}
+	}
+	if feed.Entries[0].Id == feed.Entries[1].Id {
+		t.Errorf("Occurrences share the id %q", feed.Entries[0].Id)
+	}
+}
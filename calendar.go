@@ -0,0 +1,216 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+	"pkg.monsti.org/monsti/api/util/settings"
+	mtemplate "pkg.monsti.org/monsti/api/util/template"
+)
+
+// calendarDay is a cell of the calendar grid.
+type calendarDay struct {
+	Date time.Time
+	// InMonth is false for the days of the adjacent months filling the
+	// first and last week.
+	InMonth bool
+	Today   bool
+	// Events are the events taking place on this day, at most the
+	// limit given to calendarGrid.
+	Events []eventCtx
+	// More is the number of further events taking place on this day,
+	// which are listed by the day view at DayURL.
+	More   int
+	DayURL string
+}
+
+// firstWeekday returns the first day of the week of the given site.
+func firstWeekday(site string) time.Weekday {
+	if strings.EqualFold(getSiteSettings(site).FirstDayOfWeek, "sunday") {
+		return time.Sunday
+	}
+	return time.Monday
+}
+
+// gridBounds returns the first day of the calendar grid of the month
+// starting at the given time and the day after its last one. Weeks start
+// at the given weekday.
+func gridBounds(month time.Time, firstDay time.Weekday) (time.Time,
+	time.Time) {
+	offset := (int(month.Weekday()) - int(firstDay) + 7) % 7
+	start := month.AddDate(0, 0, -offset)
+	end := start
+	for end.Before(month.AddDate(0, 1, 0)) {
+		end = end.AddDate(0, 0, 7)
+	}
+	return start, end
+}
+
+// calendarGrid returns the weeks of the month starting at the given time
+// with the given events on each day they take place. Weeks start at the
+// given weekday. Days show at most limit events if it is positive, the
+// others are counted by More.
+func calendarGrid(month time.Time, firstDay time.Weekday,
+	events []eventCtx, now time.Time, limit int) [][]calendarDay {
+	start, gridEnd := gridBounds(month, firstDay)
+	today := now.In(month.Location()).Format("2006-01-02")
+	var weeks [][]calendarDay
+	for day := start; day.Before(gridEnd); {
+		week := make([]calendarDay, 7)
+		for i := range week {
+			end := day.AddDate(0, 0, 1)
+			week[i] = calendarDay{
+				Date:    day,
+				InMonth: day.Month() == month.Month(),
+				Today:   day.Format("2006-01-02") == today,
+			}
+			for _, event := range events {
+				// Events without an end are shown on their start day.
+				if !event.Start().Before(end) || (!event.End().After(day) &&
+					event.Start().Before(day)) {
+					continue
+				}
+				if limit > 0 && len(week[i].Events) == limit {
+					week[i].More++
+				} else {
+					week[i].Events = append(week[i].Events, event)
+				}
+			}
+			day = end
+		}
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+// dayURL returns the URL of the list showing the events of the given day,
+// keeping the calendar's filters.
+func dayURL(query url.Values, day time.Time) string {
+	dayQuery := url.Values{}
+	for key, values := range query {
+		if key != "view" && key != "month" {
+			dayQuery[key] = values
+		}
+	}
+	dayQuery.Set("day", day.Format("2006-01-02"))
+	return "?" + dayQuery.Encode()
+}
+
+// monthURL returns the URL of the calendar of the given month, keeping
+// the calendar's filters.
+func monthURL(query url.Values, month time.Time) string {
+	monthQuery := url.Values{}
+	for key, values := range query {
+		monthQuery[key] = values
+	}
+	monthQuery.Set("view", "calendar")
+	monthQuery.Set("month", month.Format("2006-01"))
+	return "?" + monthQuery.Encode()
+}
+
+// getCalendarContext renders the events of the month given by the month
+// query parameter as YYYY-MM, defaulting to the current month, as a
+// calendar grid.
+func getCalendarContext(req *service.Request, s *service.Session,
+	m *settings.Monsti, renderer *mtemplate.Renderer, root string,
+	query url.Values) (map[string][]byte, *service.CacheMods, error) {
+	location := siteLocation(req.Site)
+	now := time.Now().In(location)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location)
+	if param := query.Get("month"); param != "" {
+		var err error
+		month, err = time.ParseInLocation("2006-01", param, location)
+		if err != nil {
+			return nil, nil, badRequest("Could not parse month %q: %v", param,
+				err)
+		}
+	}
+	firstDay := firstWeekday(req.Site)
+	gridStart, gridEnd := gridBounds(month, firstDay)
+	// Events starting before the grid may still be taking place on its
+	// first days, so all events before its end are fetched.
+	events, err := getEvents(req, s.Monsti(), root, eventsQuery{
+		Limit:      -1,
+		Category:   strings.TrimSpace(query.Get("category")),
+		To:         gridEnd.Add(-time.Nanosecond),
+		SkipImages: true,
+		// The calendar is shown as HTML only.
+		HideCancelled: getSiteSettings(req.Site).HideCancelled,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not retrieve events: %v", err)
+	}
+	var shown []eventCtx
+	for _, list := range [][]eventCtx{events.Ongoing, events.Upcoming,
+		events.Past} {
+		for _, event := range list {
+			if event.End().After(gridStart) ||
+				!event.Start().Before(gridStart) {
+				shown = append(shown, event)
+			}
+		}
+	}
+	weeks := calendarGrid(month, firstDay, shown, now,
+		getSiteSettings(req.Site).CalendarDayLimit)
+	for _, week := range weeks {
+		for i := range week {
+			if week[i].More > 0 {
+				week[i].DayURL = dayURL(query, week[i].Date)
+			}
+		}
+	}
+	weekdays := make([]string, 7)
+	for i := range weekdays {
+		weekdays[i] = time.Weekday((int(firstDay) + i) % 7).String()
+	}
+	prev, next := month.AddDate(0, -1, 0), month.AddDate(0, 1, 0)
+	context := mtemplate.Context{
+		"Month":        month,
+		"PrevMonth":    prev.Format("2006-01"),
+		"NextMonth":    next.Format("2006-01"),
+		"PrevMonthURL": monthURL(query, prev),
+		"NextMonthURL": monthURL(query, next),
+		"Weekdays":     weekdays,
+		"Weeks":        weeks,
+	}
+	rendered, err := renderer.Render("events/event-calendar", context,
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not render template: %v", err)
+	}
+	// The grid changes when an event shown starts soon, starts or ends
+	// and, for the current month, when the day changes. It shows no
+	// images.
+	expire := earliest(nextTransition(now, shown),
+		nextSoonChange(now, soonWindow(req.Site), shown))
+	if gridStart.Before(now) && gridEnd.After(now) {
+		expire = earliest(expire, endOfDay(now))
+	}
+	mods := &service.CacheMods{
+		Deps:   sourceDeps(root, events.Sources, descendEvents),
+		Expire: expire,
+	}
+	if events.SessionDependent {
+		mods.Expire = now
+	}
+	return map[string][]byte{"EventList": rendered}, mods, nil
+}
@@ -0,0 +1,109 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestGridBounds(t *testing.T) {
+	// March 2015 starts on a Sunday and ends on a Tuesday.
+	month := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		FirstDay   time.Weekday
+		Start, End string
+	}{
+		{time.Monday, "2015-02-23", "2015-04-06"},
+		{time.Sunday, "2015-03-01", "2015-04-05"},
+	}
+	for _, test := range tests {
+		start, end := gridBounds(month, test.FirstDay)
+		if start.Format("2006-01-02") != test.Start ||
+			end.Format("2006-01-02") != test.End {
+			t.Errorf("gridBounds(%v) = %v, %v, should be %v, %v", test.FirstDay,
+				start, end, test.Start, test.End)
+		}
+	}
+}
+
+func TestCalendarGridDayLimit(t *testing.T) {
+	month := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	var events []eventCtx
+	for i := 0; i < 5; i++ {
+		start := time.Date(2015, 3, 10, 8+i, 0, 0, 0, time.UTC)
+		events = append(events, eventCtx{Node: &service.Node{
+			Fields: map[string]service.Field{
+				"events.StartTime": &service.DateTimeField{start},
+				"events.EndTime": &service.DateTimeField{
+					start.Add(time.Hour)},
+			}}, location: time.UTC})
+	}
+	tests := []struct {
+		Limit, Shown, More int
+	}{
+		{0, 5, 0},
+		{3, 3, 2},
+		{5, 5, 0},
+		{1, 1, 4},
+	}
+	for _, test := range tests {
+		weeks := calendarGrid(month, time.Monday, events, month, test.Limit)
+		// The grid starts on Monday, February 23rd.
+		day := weeks[2][1]
+		if day.Date.Day() != 10 {
+			t.Fatalf("unexpected day %v in grid", day.Date)
+		}
+		if len(day.Events) != test.Shown || day.More != test.More {
+			t.Errorf("day with limit %v shows %v events and %v more, "+
+				"should be %v and %v", test.Limit, len(day.Events), day.More,
+				test.Shown, test.More)
+		}
+		if other := weeks[2][2]; len(other.Events) != 0 || other.More != 0 {
+			t.Errorf("next day should be empty")
+		}
+	}
+}
+
+func TestDayURL(t *testing.T) {
+	query := url.Values{"view": {"calendar"}, "month": {"2015-03"},
+		"category": {"talk"}}
+	day := time.Date(2015, 3, 10, 0, 0, 0, 0, time.UTC)
+	if got := dayURL(query, day); got != "?category=talk&day=2015-03-10" {
+		t.Errorf("dayURL() = %q", got)
+	}
+}
+
+func TestMonthURL(t *testing.T) {
+	query := url.Values{"view": {"calendar"}, "month": {"2015-03"},
+		"category": {"talk"}, "q": {"jazz"}}
+	month := time.Date(2015, 4, 1, 0, 0, 0, 0, time.UTC)
+	if got := monthURL(query, month); got !=
+		"?category=talk&month=2015-04&q=jazz&view=calendar" {
+		t.Errorf("monthURL() = %q", got)
+	}
+	if query.Get("month") != "2015-03" {
+		t.Errorf("monthURL() changed the query")
+	}
+	if got := monthURL(url.Values{}, month); got !=
+		"?month=2015-04&view=calendar" {
+		t.Errorf("monthURL() without filters = %q", got)
+	}
+}
@@ -0,0 +1,101 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"time"
+)
+
+var (
+	// lineBreaks matches HTML tags ending a line of text.
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|h[1-6])>`)
+	// blankLines matches runs of blank lines.
+	blankLines = regexp.MustCompile(`\n\s*\n\s*`)
+)
+
+// plainText converts the given HTML to plain text, keeping paragraphs
+// and line breaks as new lines.
+func plainText(text string) string {
+	text = lineBreaks.ReplaceAllString(text, "\n")
+	return blankLines.ReplaceAllString(stripHTML(text), "\n\n")
+}
+
+// calendarSpan returns the start and end of the event used by calendar
+// links, in UTC unless the event is all day. Events without end time or
+// duration last one hour.
+func calendarSpan(event eventCtx) (time.Time, time.Time) {
+	start, end := event.Start(), event.End()
+	if event.AllDay() {
+		return start, end
+	}
+	if !end.After(start) {
+		end = start.Add(time.Hour)
+	}
+	return start.UTC(), end.UTC()
+}
+
+// googleCalendarURL returns the URL adding the given event of the given
+// site to a Google calendar.
+func googleCalendarURL(site string, event eventCtx) string {
+	start, end := calendarSpan(event)
+	format := "20060102T150405Z"
+	if event.AllDay() {
+		format = "20060102"
+	}
+	query := url.Values{
+		"action":   {"TEMPLATE"},
+		"text":     {stripHTML(getText(event.Node, "core.Title"))},
+		"dates":    {start.Format(format) + "/" + end.Format(format)},
+		"details":  {calendarDetails(site, event)},
+		"location": {stripHTML(getText(event.Node, "events.Place"))},
+	}
+	return "https://calendar.google.com/calendar/render?" + query.Encode()
+}
+
+// outlookCalendarURL returns the URL adding the given event of the given
+// site to an Outlook calendar.
+func outlookCalendarURL(site string, event eventCtx) string {
+	start, end := calendarSpan(event)
+	format := "2006-01-02T15:04:05Z"
+	query := url.Values{
+		"path":     {"/calendar/action/compose"},
+		"rru":      {"addevent"},
+		"subject":  {stripHTML(getText(event.Node, "core.Title"))},
+		"body":     {calendarDetails(site, event)},
+		"location": {stripHTML(getText(event.Node, "events.Place"))},
+	}
+	if event.AllDay() {
+		query.Set("allday", "true")
+		format = "2006-01-02"
+	}
+	query.Set("startdt", start.Format(format))
+	query.Set("enddt", end.Format(format))
+	return "https://outlook.live.com/calendar/0/deeplink/compose?" +
+		query.Encode()
+}
+
+// calendarDetails returns the description of the given event of the
+// given site in calendar links: its body followed by its link.
+func calendarDetails(site string, event eventCtx) string {
+	details := plainText(getText(event.Node, "core.Body"))
+	if details != "" {
+		details += "\n\n"
+	}
+	return details + eventLink(site, event)
+}
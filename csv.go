@@ -0,0 +1,66 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// csvCell returns the given value as CSV cell. Values which spreadsheet
+// applications would take as formula are prefixed by an apostrophe, so
+// opening an export can't run formulas from event fields.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// renderCSV serializes the given events of the given site to CSV with a
+// header row. Times are given in RFC 3339 in the site's time zone.
+func renderCSV(site string, events ...[]eventCtx) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	records := [][]string{
+		{"title", "start", "end", "place", "category", "url"},
+	}
+	for _, list := range events {
+		for _, event := range list {
+			start := event.Start()
+			var end string
+			if e := event.End(); e.After(start) {
+				end = e.Format(time.RFC3339)
+			}
+			records = append(records, []string{
+				csvCell(getText(event.Node, "core.Title")),
+				start.Format(time.RFC3339),
+				end,
+				csvCell(stripHTML(getText(event.Node, "events.Place"))),
+				csvCell(event.Category()),
+				csvCell(eventLink(site, event)),
+			})
+		}
+	}
+	if err := w.WriteAll(records); err != nil {
+		return nil, fmt.Errorf("Could not write CSV: %v", err)
+	}
+	return buf.Bytes(), nil
+}
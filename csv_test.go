@@ -0,0 +1,74 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		Value, Cell string
+	}{
+		{"", ""},
+		{"Concert", "Concert"},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+49 123", "'+49 123"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+	for _, test := range tests {
+		if cell := csvCell(test.Value); cell != test.Cell {
+			t.Errorf("csvCell(%q) = %q, should be %q", test.Value, cell,
+				test.Cell)
+		}
+	}
+}
+
+func TestRenderCSVFormulas(t *testing.T) {
+	title := service.TextField("=1+1")
+	place := service.TextField("@Town hall")
+	event := eventCtx{Node: &service.Node{Path: "/events/foo",
+		Fields: map[string]service.Field{
+			"core.Title":   &title,
+			"events.Place": &place,
+			"events.StartTime": &service.DateTimeField{time.Date(2015, 3, 1,
+				10, 0, 0, 0, time.UTC)},
+		}}, location: time.UTC}
+	out, err := renderCSV("example", []eventCtx{event})
+	if err != nil {
+		t.Fatalf("renderCSV() failed: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("renderCSV() returned %q: %v", out, err)
+	}
+	if records[1][0] != "'=1+1" || records[1][3] != "'@Town hall" {
+		t.Errorf("renderCSV() returned record %q", records[1])
+	}
+	if records[1][1] != "2015-03-01T10:00:00Z" {
+		t.Errorf("renderCSV() returned start %q", records[1][1])
+	}
+}
@@ -0,0 +1,103 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Formats of dates and times in locales without a translated format.
+const (
+	defaultDateFormat     = "2006-01-02"
+	defaultDateTimeFormat = "2006-01-02 15:04"
+)
+
+// dateFormats and dateTimeFormats map locales to the translations of
+// the Go layouts of dates with and without time, monthNames the months
+// to the translations of their English names. They are generated during
+// setup, so translating the layouts adds the format of a locale.
+var (
+	dateFormats, dateTimeFormats map[string]string
+	monthNames                   = make(map[time.Month]map[string]string)
+)
+
+// formatDate formats the given time in the given locale, including the
+// time of day if withTime is true.
+func formatDate(t time.Time, locale string, withTime bool) string {
+	formats, format := dateFormats, defaultDateFormat
+	if withTime {
+		formats, format = dateTimeFormats, defaultDateTimeFormat
+	}
+	if layout, ok := formats[locale]; ok && layout != "" {
+		format = layout
+	}
+	out := t.Format(format)
+	if name, ok := monthNames[t.Month()][locale]; ok && name != "" &&
+		strings.Contains(format, "January") {
+		out = strings.Replace(out, t.Month().String(), name, 1)
+	}
+	return out
+}
+
+// FormattedStart returns the start of the event formatted in the given
+// locale, without time of day for all day events.
+func (e eventCtx) FormattedStart(locale string) string {
+	return formatDate(e.Start(), locale, !e.AllDay())
+}
+
+// FormattedEnd returns the end of the event formatted in the given
+// locale. All day events show their last day.
+func (e eventCtx) FormattedEnd(locale string) string {
+	if e.AllDay() {
+		return formatDate(e.End().Add(-time.Nanosecond), locale, false)
+	}
+	return formatDate(e.End(), locale, true)
+}
+
+// ISOStart returns the start of the event in the site's time zone as
+// RFC 3339 date time, e.g. for the datetime attribute of time elements.
+// It is empty if the event has no start.
+func (e eventCtx) ISOStart() string {
+	if _, ok := getTime(e.Node, "events.StartTime"); !ok {
+		return ""
+	}
+	return e.Start().Format(time.RFC3339)
+}
+
+// ISOEnd returns the end of the event like ISOStart. It is empty if the
+// event has neither an end time nor a duration and doesn't last all day.
+func (e eventCtx) ISOEnd() string {
+	if e.ISOStart() == "" || !e.hasEnd() {
+		return ""
+	}
+	return e.End().Format(time.RFC3339)
+}
+
+// hasEnd checks if the end of the event is known, i.e. if it has a valid
+// end time or duration or lasts all day.
+func (e eventCtx) hasEnd() bool {
+	if e.AllDay() {
+		return true
+	}
+	if end, ok := getTime(e.Node, "events.EndTime"); ok &&
+		!end.Before(startTime(e.Node)) {
+		return true
+	}
+	_, err := parseDuration(getText(e.Node, "events.Duration"))
+	return err == nil
+}
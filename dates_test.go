@@ -0,0 +1,62 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestISOEnd(t *testing.T) {
+	start := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	yes, duration, zero := service.BoolField(true), service.TextField("PT2H"),
+		service.TextField("PT0S")
+	tests := []struct {
+		Fields map[string]service.Field
+		End    string
+	}{
+		{map[string]service.Field{}, ""},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start}}, ""},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start},
+			"events.EndTime":   &service.DateTimeField{start}},
+			"2015-03-01T10:00:00Z"},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start},
+			"events.Duration":  &duration}, "2015-03-01T12:00:00Z"},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start},
+			"events.Duration":  &zero}, "2015-03-01T10:00:00Z"},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start},
+			"events.EndTime":   &service.DateTimeField{start.Add(-time.Hour)}},
+			""},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start},
+			"events.AllDay":    &yes}, "2015-03-02T00:00:00Z"},
+	}
+	for i, test := range tests {
+		event := eventCtx{Node: &service.Node{Fields: test.Fields},
+			location: time.UTC}
+		if end := event.ISOEnd(); end != test.End {
+			t.Errorf("%d: ISOEnd() = %q, should be %q", i, end, test.End)
+		}
+	}
+}
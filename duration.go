@@ -0,0 +1,132 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDuration matches ISO 8601 durations using weeks, days, hours,
+// minutes and seconds, e.g. P1DT2H or PT2H30M.
+var isoDuration = regexp.MustCompile(
+	`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// maxDuration is the longest duration accepted by parseDuration. It is
+// far below the range of time.Duration, so summing the parts of a
+// duration can't overflow.
+const maxDuration = 5 * 365 * 24 * time.Hour
+
+// parseDuration parses the given ISO 8601 duration. Years and months are
+// not supported as their length is ambiguous. Durations longer than
+// maxDuration are rejected.
+func parseDuration(value string) (time.Duration, error) {
+	match := isoDuration.FindStringSubmatch(value)
+	if match == nil || value == "P" || value[len(value)-1] == 'T' {
+		return 0, fmt.Errorf("Invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour,
+		time.Minute, time.Second}
+	var duration time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		amount, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration %q: %v", value, err)
+		}
+		if time.Duration(amount) > (maxDuration-duration)/unit {
+			return 0, fmt.Errorf("Duration %q is too long", value)
+		}
+		duration += time.Duration(amount) * unit
+	}
+	return duration, nil
+}
+
+// durationUnits contains the phrases of the parts of a duration in a
+// single locale, taking the number of units.
+type durationUnits struct {
+	Day, Days, Hours, Minutes string
+}
+
+// durationPhrases contains the phrases of durations in the available
+// locales and in English. They are generated during setup, see
+// genDurationPhrases.
+var durationPhrases map[string]durationUnits
+
+// genDurationPhrases generates durationPhrases from the translations of
+// the English phrases.
+func genDurationPhrases() {
+	G := func(in string) string { return in }
+	english := durationUnits{G("%d day"), G("%d days"), G("%dh"), G("%dm")}
+	durationPhrases = map[string]durationUnits{"en": english}
+	for _, locale := range availableLocales {
+		units := english
+		translatePhrases(locale, &units.Day, &units.Days, &units.Hours,
+			&units.Minutes)
+		durationPhrases[locale] = units
+	}
+}
+
+// Duration returns the time between the start and the end of the event.
+// It is zero if the event has neither an end time nor a duration.
+func (e eventCtx) Duration() time.Duration {
+	_, hasEnd := getTime(e.Node, "events.EndTime")
+	_, err := parseDuration(getText(e.Node, "events.Duration"))
+	if !hasEnd && err != nil {
+		return 0
+	}
+	return e.End().Sub(e.Start())
+}
+
+// FormattedDuration describes the duration of the event in the given
+// locale, e.g. "2h 30m", or in days and hours if it lasts more than a
+// day. It is empty if the event has no duration. Unavailable locales
+// fall back to English.
+func (e eventCtx) FormattedDuration(locale string) string {
+	return formatDuration(e.Duration(), locale)
+}
+
+// formatDuration describes the given duration in the given locale, see
+// FormattedDuration.
+func formatDuration(duration time.Duration, locale string) string {
+	phrases, ok := durationPhrases[locale]
+	if !ok {
+		phrases = durationPhrases["en"]
+	}
+	days := int(duration / (24 * time.Hour))
+	hours := int(duration % (24 * time.Hour) / time.Hour)
+	minutes := int(duration % time.Hour / time.Minute)
+	var parts []string
+	switch {
+	case days == 1:
+		parts = append(parts, fmt.Sprintf(phrases.Day, days))
+	case days > 1:
+		parts = append(parts, fmt.Sprintf(phrases.Days, days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf(phrases.Hours, hours))
+	}
+	if minutes > 0 && days == 0 {
+		parts = append(parts, fmt.Sprintf(phrases.Minutes, minutes))
+	}
+	return strings.Join(parts, " ")
+}
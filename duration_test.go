@@ -0,0 +1,84 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		Value    string
+		Duration time.Duration
+		Valid    bool
+	}{
+		{"PT2H", 2 * time.Hour, true},
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"PT0S", 0, true},
+		{"", 0, false},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1DT", 0, false},
+		{"2 hours", 0, false},
+		{"P260W", 260 * 7 * 24 * time.Hour, true},
+		{"P1826D", 0, false},
+		{"PT9999999999999H", 0, false},
+		{"PT99999999999999999999S", 0, false},
+		{"P260WT9999999H", 0, false},
+	}
+	for _, test := range tests {
+		duration, err := parseDuration(test.Value)
+		if (err == nil) != test.Valid || duration != test.Duration {
+			t.Errorf("parseDuration(%q) = %v, %v, should be %v, valid: %v",
+				test.Value, duration, err, test.Duration, test.Valid)
+		}
+	}
+}
+
+func TestFormattedDuration(t *testing.T) {
+	genDurationPhrases()
+	start := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		End       time.Time
+		Formatted string
+	}{
+		{time.Time{}, ""},
+		{start.Add(2*time.Hour + 30*time.Minute), "2h 30m"},
+		{start.Add(45 * time.Minute), "45m"},
+		{start.Add(26 * time.Hour), "1 day 2h"},
+		{start.Add(72*time.Hour + 10*time.Minute), "3 days"},
+	}
+	for _, test := range tests {
+		fields := map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start}}
+		if !test.End.IsZero() {
+			fields["events.EndTime"] = &service.DateTimeField{test.End}
+		}
+		event := eventCtx{Node: &service.Node{Fields: fields},
+			location: time.UTC}
+		if formatted := event.FormattedDuration("en"); formatted !=
+			test.Formatted {
+			t.Errorf("FormattedDuration() of event ending at %v = %q, "+
+				"should be %q", test.End, formatted, test.Formatted)
+		}
+	}
+}
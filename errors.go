@@ -0,0 +1,107 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Kinds of errors reported to integrators.
+const (
+	errorNotFound   = "not-found"
+	errorBadRequest = "bad-request"
+	errorForbidden  = "forbidden"
+	errorInternal   = "internal"
+)
+
+// requestError is an error caused by the request rather than by the
+// module, e.g. a malformed query parameter.
+type requestError struct {
+	Kind    string
+	Message string
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// notFound returns a not-found error with the given formatted message.
+func notFound(format string, args ...interface{}) error {
+	return &requestError{errorNotFound, fmt.Sprintf(format, args...)}
+}
+
+// badRequest returns a bad-request error with the given formatted
+// message.
+func badRequest(format string, args ...interface{}) error {
+	return &requestError{errorBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// forbidden returns a forbidden error with the given formatted message.
+func forbidden(format string, args ...interface{}) error {
+	return &requestError{errorForbidden, fmt.Sprintf(format, args...)}
+}
+
+// errorStatus returns the kind and HTTP status code of the given error.
+// Errors not caused by the request are internal ones.
+func errorStatus(err error) (string, int) {
+	if err, ok := err.(*requestError); ok {
+		switch err.Kind {
+		case errorNotFound:
+			return err.Kind, 404
+		case errorBadRequest:
+			return err.Kind, 400
+		case errorForbidden:
+			return err.Kind, 403
+		}
+	}
+	return errorInternal, 500
+}
+
+// errorResponse builds a context containing a JSON description of the
+// given error and its HTTP status code. The messages of internal errors
+// are not exposed.
+func errorResponse(err error) map[string][]byte {
+	kind, status := errorStatus(err)
+	message := err.Error()
+	if kind == errorInternal {
+		message = "Internal error"
+	}
+	body, _ := json.Marshal(struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{kind, message})
+	ret := rawResponse(body, "application/json")
+	ret[rawStatusKey] = []byte(strconv.Itoa(status))
+	return ret
+}
+
+// rawRequest checks if the given events list query asks for a non-HTML
+// response, whose errors are reported by errorResponse.
+func rawRequest(query url.Values) bool {
+	switch query.Get("view") {
+	case "report", "overview", "import":
+		return true
+	}
+	switch query.Get("format") {
+	case "ics", "csv", "json", "atom", "sitemap":
+		return true
+	}
+	return false
+}
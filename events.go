@@ -0,0 +1,1524 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+	"pkg.monsti.org/monsti/api/util/nodes"
+)
+
+// getTime returns the time of the given date time field or false if the
+// node has no such field.
+func getTime(node *service.Node, id string) (time.Time, bool) {
+	field, ok := node.Fields[id].(*service.DateTimeField)
+	if !ok || field == nil || field.Time.IsZero() {
+		return time.Time{}, false
+	}
+	return field.Time, true
+}
+
+// getText returns the string value of the given field or the empty
+// string if the node has no such field.
+func getText(node *service.Node, id string) string {
+	field, ok := node.Fields[id]
+	if !ok || field == nil {
+		return ""
+	}
+	return field.String()
+}
+
+// getBool returns the value of the given boolean field or false if the
+// node has no such field.
+func getBool(node *service.Node, id string) bool {
+	field, ok := node.Fields[id].(*service.BoolField)
+	return ok && field != nil && bool(*field)
+}
+
+// getCount returns the non-negative integer given by the text of the
+// given field or false if the node has no such field or it does not
+// contain a non-negative integer.
+func getCount(node *service.Node, id string) (int, bool) {
+	value, err := strconv.Atoi(strings.TrimSpace(getText(node, id)))
+	return value, err == nil && value >= 0
+}
+
+// byStart orders events by start time. Events starting at the same time
+// are ordered by path, so lists don't change between renders.
+func byStart(left, right *service.Node) bool {
+	leftStart, rightStart := startTime(left), startTime(right)
+	if leftStart.Equal(rightStart) {
+		return left.Path < right.Path
+	}
+	return leftStart.Before(rightStart)
+}
+
+// getFloat returns the number given by the text of the given field or
+// false if the node has no such field or it is not a number.
+func getFloat(node *service.Node, id string) (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(getText(node, id)), 64)
+	return value, err == nil
+}
+
+// copyNode returns a copy of the given node whose fields may be replaced
+// without changing the original.
+func copyNode(node *service.Node) *service.Node {
+	ret := *node
+	ret.Fields = make(map[string]service.Field, len(node.Fields))
+	for id, field := range node.Fields {
+		ret.Fields[id] = field
+	}
+	return &ret
+}
+
+// startTime returns the start time of the given event node.
+func startTime(node *service.Node) time.Time {
+	start, _ := getTime(node, "events.StartTime")
+	return start
+}
+
+type eventCtx struct {
+	*service.Node
+	// Images are the event's child images ordered by path.
+	Images []*service.Node
+	// location is the time zone of the site, used to compute calendar
+	// days and to present times.
+	location *time.Location
+	// soon is the site's window before their start during which events
+	// start soon, see soonWindow. Zero means the default window.
+	soon time.Duration
+}
+
+// zone returns the time zone of the event's site.
+func (e eventCtx) zone() *time.Location {
+	if e.location == nil {
+		return time.Local
+	}
+	return e.location
+}
+
+// Start returns the start of the event in the site's time zone.
+func (e eventCtx) Start() time.Time {
+	return startTime(e.Node).In(e.zone())
+}
+
+// startOfDay returns the start of the day of the given time.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// endOfDay returns the start of the day following the given time.
+func endOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+}
+
+// eventImage is an image of an event along with its alternative text.
+type eventImage struct {
+	*service.Node
+	// Alt is the title of the image or, if untitled, of the event.
+	Alt string
+}
+
+// newEventImage returns the given image of the given event.
+func newEventImage(event, image *service.Node) eventImage {
+	alt := strings.TrimSpace(getText(image, "core.Title"))
+	if alt == "" {
+		alt = getText(event, "core.Title")
+	}
+	return eventImage{Node: image, Alt: alt}
+}
+
+// eventImages returns the given images of the given event.
+func eventImages(event *service.Node, images []*service.Node) []eventImage {
+	ret := make([]eventImage, len(images))
+	for i, image := range images {
+		ret[i] = newEventImage(event, image)
+	}
+	return ret
+}
+
+// coverPath returns the path of the image selected as cover of the
+// given event, which may be given relative to the event, or the empty
+// string if none is selected.
+func coverPath(event *service.Node) string {
+	ref := strings.TrimSpace(getText(event, "events.CoverImage"))
+	if ref == "" {
+		return ""
+	}
+	if !strings.HasPrefix(ref, "/") {
+		ref = path.Join(event.Path, ref)
+	}
+	return path.Clean(ref)
+}
+
+// coverImage returns the image of the given event's images selected as
+// its cover, falling back to the first one. It is nil if there are no
+// images.
+func coverImage(event *service.Node, images []*service.Node) *service.Node {
+	if len(images) == 0 {
+		return nil
+	}
+	if cover := coverPath(event); cover != "" {
+		for _, image := range images {
+			if image.Path == cover {
+				return image
+			}
+		}
+	}
+	return images[0]
+}
+
+// Cover returns the image selected as cover of the event or, if none
+// is selected, its first image. It is nil if there are no images.
+func (e eventCtx) Cover() *eventImage {
+	image := coverImage(e.Node, e.Images)
+	if image == nil {
+		return nil
+	}
+	cover := newEventImage(e.Node, image)
+	return &cover
+}
+
+// nodeTypeId returns the id of the type of the given node or the empty
+// string if unknown.
+func nodeTypeId(node *service.Node) string {
+	if node.Type == nil {
+		return ""
+	}
+	return node.Type.Id
+}
+
+// getMedia returns the images and the file attachments of the event at
+// the given path, each ordered by path. Children of unknown type are
+// taken as images.
+func getMedia(m nodeReader, site, path string) (images,
+	attachments []*service.Node, err error) {
+	children, err := m.GetChildren(site, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not fetch children: %v", err)
+	}
+	order := func(left, right *service.Node) bool {
+		return left.Path < right.Path
+	}
+	sort.Sort(&nodes.Sorter{children, order})
+	attachments = []*service.Node{}
+	for _, child := range children {
+		switch nodeTypeId(child) {
+		case "core.File":
+			attachments = append(attachments, child)
+		case "core.Image", "":
+			images = append(images, child)
+		}
+	}
+	return images, attachments, nil
+}
+
+// getImages returns the images of the event at the given path ordered by
+// path.
+func getImages(m nodeReader, site, path string) ([]*service.Node,
+	error) {
+	images, _, err := getMedia(m, site, path)
+	return images, err
+}
+
+// eventAttachment is a downloadable file of an event.
+type eventAttachment struct {
+	Name, URL string
+}
+
+// eventAttachments returns the given attachments of an event, named by
+// their title or, if untitled, by their file name.
+func eventAttachments(attachments []*service.Node) []eventAttachment {
+	ret := make([]eventAttachment, len(attachments))
+	for i, attachment := range attachments {
+		name := strings.TrimSpace(getText(attachment, "core.Title"))
+		if name == "" {
+			name = path.Base(attachment.Path)
+		}
+		ret[i] = eventAttachment{Name: name, URL: attachment.Path}
+	}
+	return ret
+}
+
+// AllDay checks if the event lasts all day without a meaningful time of
+// day.
+func (e eventCtx) AllDay() bool {
+	return getBool(e.Node, "events.AllDay")
+}
+
+// End returns the end of the event as given by its end time or, if
+// unset, its duration. Events without either, or with an end time
+// before their start, end at their start time. All day events end at the
+// end of their last day.
+func (e eventCtx) End() time.Time {
+	end, ok := getTime(e.Node, "events.EndTime")
+	if !ok || end.Before(startTime(e.Node)) {
+		end = startTime(e.Node)
+		duration, err := parseDuration(getText(e.Node, "events.Duration"))
+		if err == nil {
+			end = end.Add(duration)
+		}
+	}
+	// Converting to the site's time zone keeps the instant, so times
+	// already carrying a location are not shifted.
+	end = end.In(e.zone())
+	if e.AllDay() {
+		return endOfDay(end)
+	}
+	return end
+}
+
+// Upcoming checks if this is an upcoming or ongoing event.
+func (e eventCtx) Upcoming() bool {
+	return e.End().After(time.Now())
+}
+
+// Ongoing checks if the event has started but is not over yet.
+func (e eventCtx) Ongoing() bool {
+	now := time.Now()
+	return !startTime(e.Node).After(now) && e.End().After(now)
+}
+
+// OccursOn checks if the event takes place on the day of the given time
+// in the site's time zone, i.e. starts on it or spans it.
+func (e eventCtx) OccursOn(day time.Time) bool {
+	dayStart := startOfDay(day.In(e.zone()))
+	start := e.Start()
+	return start.Before(endOfDay(dayStart)) &&
+		(e.End().After(dayStart) || !start.Before(dayStart))
+}
+
+// IsToday checks if the event takes place today.
+func (e eventCtx) IsToday() bool {
+	return e.OccursOn(time.Now())
+}
+
+// Event states.
+const (
+	statusScheduled = "scheduled"
+	statusCancelled = "cancelled"
+	statusPostponed = "postponed"
+)
+
+// Status returns the state of the event, which is one of "scheduled",
+// "cancelled" or "postponed". Events without a valid state are
+// scheduled.
+func (e eventCtx) Status() string {
+	switch status := strings.ToLower(getText(e.Node, "events.Status")); status {
+	case statusCancelled, statusPostponed:
+		return status
+	}
+	return statusScheduled
+}
+
+// Cancelled checks if the event has been cancelled.
+func (e eventCtx) Cancelled() bool {
+	return e.Status() == statusCancelled
+}
+
+// Latitude returns the latitude of the event's location in degrees.
+func (e eventCtx) Latitude() float64 {
+	latitude, _ := getFloat(e.Node, "events.Latitude")
+	return latitude
+}
+
+// Longitude returns the longitude of the event's location in degrees.
+func (e eventCtx) Longitude() float64 {
+	longitude, _ := getFloat(e.Node, "events.Longitude")
+	return longitude
+}
+
+// HasLocation checks if the event has valid coordinates to show it on a
+// map. Missing or zero coordinates mean no location.
+func (e eventCtx) HasLocation() bool {
+	latitude, ok := getFloat(e.Node, "events.Latitude")
+	if !ok || latitude < -90 || latitude > 90 {
+		return false
+	}
+	longitude, ok := getFloat(e.Node, "events.Longitude")
+	if !ok || longitude < -180 || longitude > 180 {
+		return false
+	}
+	return latitude != 0 || longitude != 0
+}
+
+// validURL checks if the given text is an absolute http or https URL.
+func validURL(text string) bool {
+	u, err := url.Parse(text)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		u.Host != ""
+}
+
+// ExternalURL returns the URL of the event's page on another site or the
+// empty string if the event is hosted here or the URL is invalid.
+func (e eventCtx) ExternalURL() string {
+	external := strings.TrimSpace(getText(e.Node, "events.ExternalURL"))
+	if !validURL(external) {
+		return ""
+	}
+	return external
+}
+
+// validEmail checks if the given text is a plain email address.
+func validEmail(text string) bool {
+	address, err := mail.ParseAddress(text)
+	return err == nil && address.Name == "" && address.Address == text
+}
+
+// ContactEmail returns the contact email address of the event or the
+// empty string if it has none or it is invalid.
+func (e eventCtx) ContactEmail() string {
+	email := strings.TrimSpace(getText(e.Node, "events.ContactEmail"))
+	if !validEmail(email) {
+		return ""
+	}
+	return email
+}
+
+// HasContact checks if the event has a valid contact email address.
+func (e eventCtx) HasContact() bool {
+	return e.ContactEmail() != ""
+}
+
+// Link returns the URL of the event's page, which is its external URL if
+// any. Occurrences of recurring events link to the page of their base
+// event showing the occurrence, see findOccurrence.
+func (e eventCtx) Link() string {
+	if external := e.ExternalURL(); external != "" {
+		return external
+	}
+	if e.IsOccurrence() {
+		return e.Path + "/?occurrence=" + e.OccurrenceDate()
+	}
+	return e.Path + "/"
+}
+
+// Attendance modes of events.
+const (
+	typeInPerson = "in-person"
+	typeOnline   = "online"
+	typeHybrid   = "hybrid"
+)
+
+// EventType returns how the event is attended, which is one of
+// "in-person", "online" or "hybrid". Events without a valid type take
+// place in person.
+func (e eventCtx) EventType() string {
+	switch eventType := strings.ToLower(strings.TrimSpace(
+		getText(e.Node, "events.EventType"))); eventType {
+	case typeOnline, typeHybrid:
+		return eventType
+	}
+	return typeInPerson
+}
+
+// StreamURL returns the URL to attend an online or hybrid event or the
+// empty string if the event takes place in person or has no valid URL.
+func (e eventCtx) StreamURL() string {
+	stream := strings.TrimSpace(getText(e.Node, "events.StreamURL"))
+	if e.EventType() == typeInPerson || !validURL(stream) {
+		return ""
+	}
+	return stream
+}
+
+// Organizer returns the organizer of the event or the empty string if
+// the event has no organizer of its own.
+func (e eventCtx) Organizer() string {
+	return strings.TrimSpace(getText(e.Node, "events.Organizer"))
+}
+
+// RegistrationDeadline returns the time registration for the event
+// closes, which is its start unless it has an earlier deadline.
+func (e eventCtx) RegistrationDeadline() time.Time {
+	start := startTime(e.Node)
+	deadline, ok := getTime(e.Node, "events.RegistrationDeadline")
+	if !ok || deadline.After(start) {
+		deadline = start
+	}
+	return deadline.In(e.zone())
+}
+
+// RegistrationOpen checks if registration for the event is still open.
+func (e eventCtx) RegistrationOpen() bool {
+	return time.Now().Before(e.RegistrationDeadline())
+}
+
+// Category returns the category of the event.
+func (e eventCtx) Category() string {
+	return getText(e.Node, "events.Category")
+}
+
+// Featured checks if this event has been marked as featured.
+func (e eventCtx) Featured() bool {
+	return getBool(e.Node, "events.Featured")
+}
+
+// LastModified returns the time of the last modification of the event
+// or nil if it is unknown.
+func (e eventCtx) LastModified() *time.Time {
+	if e.Changed.IsZero() {
+		return nil
+	}
+	changed := e.Changed
+	return &changed
+}
+
+// Pinned checks if this event has been pinned to the top of the list.
+func (e eventCtx) Pinned() bool {
+	return getBool(e.Node, "events.Pinned")
+}
+
+// Restricted checks if the event is only visible to logged in users.
+func (e eventCtx) Restricted() bool {
+	return getBool(e.Node, "events.Restricted")
+}
+
+// Capacity returns the number of spots of the event or zero if there is
+// no limit.
+func (e eventCtx) Capacity() int {
+	capacity, _ := getCount(e.Node, "events.Capacity")
+	return capacity
+}
+
+// SpotsLeft returns the number of free spots of the event or nil if
+// there is no limit.
+func (e eventCtx) SpotsLeft() *int {
+	capacity := e.Capacity()
+	if capacity == 0 {
+		return nil
+	}
+	registered, _ := getCount(e.Node, "events.Registered")
+	left := capacity - registered
+	if left < 0 {
+		left = 0
+	}
+	return &left
+}
+
+// IsFull checks if the event has been marked as sold out or all of its
+// spots are taken.
+func (e eventCtx) IsFull() bool {
+	if getBool(e.Node, "events.SoldOut") {
+		return true
+	}
+	left := e.SpotsLeft()
+	return left != nil && *left == 0
+}
+
+// CSSClasses returns a space separated list of class names which
+// describe the state of the event, so themes may style e.g. featured
+// events without recomputing their state. Events starting within the
+// site's window get the starts soon class, see StartsSoon.
+func (e eventCtx) CSSClasses() string {
+	var classes []string
+	if e.Ongoing() {
+		classes = append(classes, "monsti-events--event-ongoing")
+	} else if e.Upcoming() {
+		classes = append(classes, "monsti-events--event-upcoming")
+	} else {
+		classes = append(classes, "monsti-events--event-past")
+	}
+	if status := e.Status(); status != statusScheduled {
+		classes = append(classes, "monsti-events--event-"+status)
+	}
+	if e.Featured() {
+		classes = append(classes, "monsti-events--event-featured")
+	}
+	if e.IsFull() {
+		classes = append(classes, "monsti-events--event-sold-out")
+	}
+	if e.IsToday() {
+		classes = append(classes, "monsti-events--event-today")
+	}
+	soon := e.soon
+	if soon == 0 {
+		soon = defaultSoonWindow
+	}
+	if e.StartsSoon(soon) {
+		classes = append(classes, "monsti-events--event-starts-soon")
+	}
+	classes = append(classes, "monsti-events--event-"+e.EventType())
+	return strings.Join(classes, " ")
+}
+
+// featuredFirst moves the featured events to the front of the given
+// slice. The order of the featured and the other events is retained.
+func featuredFirst(events []eventCtx) {
+	ordered := make([]eventCtx, 0, len(events))
+	for _, event := range events {
+		if event.Featured() {
+			ordered = append(ordered, event)
+		}
+	}
+	for _, event := range events {
+		if !event.Featured() {
+			ordered = append(ordered, event)
+		}
+	}
+	copy(events, ordered)
+}
+
+// authenticated checks if the request has been made by a logged in
+// user.
+func authenticated(req *service.Request) bool {
+	return req.Session != nil && req.Session.User != nil
+}
+
+// scheduled checks if the visibility window of the given event opens
+// after the given time. Unset bounds mean always visible.
+func scheduled(event *service.Node, now time.Time) bool {
+	from, ok := getTime(event, "events.VisibleFrom")
+	return ok && now.Before(from)
+}
+
+// withdrawn checks if the visibility window of the given event closed
+// before the given time.
+func withdrawn(event *service.Node, now time.Time) bool {
+	until, ok := getTime(event, "events.VisibleUntil")
+	return ok && !now.Before(until)
+}
+
+// visibilityChange returns the earliest start or end of the visibility
+// window of any of the given events after now, or the zero time if
+// there is none.
+func visibilityChange(events []*service.Node, now time.Time) time.Time {
+	var next time.Time
+	for _, event := range events {
+		for _, id := range []string{"events.VisibleFrom",
+			"events.VisibleUntil"} {
+			if t, ok := getTime(event, id); ok && t.After(now) {
+				next = earliest(next, t)
+			}
+		}
+	}
+	return next
+}
+
+// requiredRole returns the role needed to see the given event or the
+// empty string if the event is public.
+func requiredRole(event *service.Node) string {
+	return strings.TrimSpace(getText(event, "events.RequiredRole"))
+}
+
+// accessible checks if the user of the given request may see the given
+// event, regardless of its publication window. Restricted events are
+// accessible to logged in users, events requiring a role to its holders.
+func accessible(req *service.Request, event *service.Node) bool {
+	return hasRole(req, requiredRole(event)) &&
+		(authenticated(req) || !getBool(event, "events.Restricted"))
+}
+
+// visibleEvents returns the given events accessible to the user of the
+// given request, see accessible. Events whose visibility window did not
+// open yet are only returned to editors previewing the list, see
+// isEditor. Events whose window closed are returned to nobody, so lists
+// don't depend on the session forever once events are withdrawn.
+func visibleEvents(req *service.Request,
+	events []*service.Node) []*service.Node {
+	now := time.Now()
+	editor := isEditor(req)
+	return filterEvents(events, func(event *service.Node) bool {
+		return accessible(req, event) && !withdrawn(event, now) &&
+			(editor || !scheduled(event, now))
+	})
+}
+
+// sessionDependent checks if what requests may see of the given events
+// depends on their session, see visibleEvents. Renders of such events
+// must not be shared through the cache, which is keyed by the URL only.
+// Withdrawn events are hidden from everybody and don't count; the
+// renders expire when windows open or close, see visibilityChange.
+func sessionDependent(events []*service.Node, now time.Time) bool {
+	for _, event := range events {
+		if withdrawn(event, now) {
+			continue
+		}
+		if getBool(event, "events.Restricted") || requiredRole(event) != "" ||
+			scheduled(event, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// expireIfSessionDependent makes the given cache modifications expire
+// immediately if the render depends on the session, see
+// sessionDependent.
+func expireIfSessionDependent(mods *service.CacheMods,
+	events ...[]*service.Node) {
+	now := time.Now()
+	for _, list := range events {
+		if sessionDependent(list, now) {
+			mods.Expire = now
+			return
+		}
+	}
+}
+
+// filterEvents returns the events for which keep returns true.
+func filterEvents(events []*service.Node,
+	keep func(*service.Node) bool) []*service.Node {
+	var ret []*service.Node
+	for _, event := range events {
+		if keep(event) {
+			ret = append(ret, event)
+		}
+	}
+	return ret
+}
+
+// matchesTerms checks if the title, body or place of the given event
+// contain each of the given lower case terms.
+func matchesTerms(event *service.Node, terms []string) bool {
+	text := strings.ToLower(strings.Join([]string{
+		getText(event, "core.Title"),
+		stripHTML(getText(event, "core.Body")),
+		stripHTML(getText(event, "events.Place")),
+	}, "\n"))
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// takePinned removes the pinned events from the given events. It returns
+// the remaining events and the pinned ones, both in their given order.
+// If unpinPast is true, past events are not pinned anymore.
+func takePinned(events []*service.Node, unpinPast bool,
+	location *time.Location) ([]*service.Node, []eventCtx) {
+	var rest []*service.Node
+	var pinned []eventCtx
+	for _, node := range events {
+		event := eventCtx{Node: node, location: location}
+		if event.Pinned() && (!unpinPast || event.Upcoming()) {
+			pinned = append(pinned, event)
+		} else {
+			rest = append(rest, node)
+		}
+	}
+	return rest, pinned
+}
+
+// getSiblings returns the events chronologically before and after the
+// given event in its list. Either one is nil if the event is the first
+// or last one. personal tells if they depend on the request's session.
+func getSiblings(req *service.Request, s *service.Session,
+	event *service.Node) (prev, next *service.Node, personal bool,
+	err error) {
+	events, err := s.Monsti().GetChildren(req.Site, path.Dir(event.Path))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Could not fetch siblings: %v",
+			err)
+	}
+	personal = sessionDependent(events, time.Now())
+	events = localizeEvents(visibleEvents(req, events), requestLocale(req))
+	sort.Sort(&nodes.Sorter{events, byStart})
+	for i, sibling := range events {
+		if sibling.Path != event.Path {
+			continue
+		}
+		if i > 0 {
+			prev = events[i-1]
+		}
+		if i < len(events)-1 {
+			next = events[i+1]
+		}
+		break
+	}
+	return prev, next, personal, nil
+}
+
+// reverseEvents reverses the order of the given events.
+func reverseEvents(events []eventCtx) {
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+}
+
+// Sort orders of event lists.
+const (
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
+
+// relatedPaths returns the paths of the events referenced by the
+// RelatedEvents field of the given event. References are separated by
+// commas or white space, relative ones are relative to the event's list.
+// References to the event itself are ignored, repeated ones are returned
+// once. The related events' own references are not followed, so cycles
+// don't matter.
+func relatedPaths(event *service.Node) []string {
+	var paths []string
+	separator := func(r rune) bool {
+		return r == ',' || strings.ContainsRune(" \t\r\n", r)
+	}
+	seen := map[string]bool{path.Clean(event.Path): true}
+	for _, ref := range strings.FieldsFunc(
+		getText(event, "events.RelatedEvents"), separator) {
+		if !strings.HasPrefix(ref, "/") {
+			ref = path.Join(path.Dir(event.Path), ref)
+		}
+		if ref = path.Clean(ref); !seen[ref] {
+			seen[ref] = true
+			paths = append(paths, ref)
+		}
+	}
+	return paths
+}
+
+// getRelated returns the events referenced by the given event which
+// exist and are visible to the request. Broken references are dropped.
+// personal tells if they depend on the request's session.
+func getRelated(req *service.Request, s *service.Session,
+	event *service.Node) (ret []eventCtx, personal bool) {
+	location := siteLocation(req.Site)
+	var related []*service.Node
+	for _, ref := range relatedPaths(event) {
+		node, err := s.Monsti().GetNode(req.Site, ref)
+		if err == nil && node != nil {
+			related = append(related, node)
+		}
+	}
+	personal = sessionDependent(related, time.Now())
+	related = localizeEvents(visibleEvents(req, related), requestLocale(req))
+	ret = make([]eventCtx, len(related))
+	for i, node := range related {
+		ret[i] = eventCtx{Node: node, location: location,
+			soon: soonWindow(req.Site)}
+	}
+	return ret, personal
+}
+
+// eventsQuery selects the events of a list.
+type eventsQuery struct {
+	PastOnly, UpcomingOnly bool
+	// OngoingOnly selects the ongoing events only.
+	OngoingOnly bool
+	// Order is orderAsc or orderDesc to sort all events by ascending or
+	// descending start time. By default, upcoming events are soonest
+	// first and past events most recent first.
+	Order string
+	// FeaturedOnTop moves featured upcoming events to the top.
+	FeaturedOnTop bool
+	// FeaturedOnly selects featured events only.
+	FeaturedOnly bool
+	// HideCancelled leaves out cancelled events.
+	HideCancelled bool
+	// Limit is the maximum number of upcoming and of past events or -1 if
+	// unlimited. Ongoing events are not limited.
+	Limit int
+	// Offset is the number of past events to skip.
+	Offset int
+	// Category selects events of this category, ignoring case, if not
+	// empty.
+	Category string
+	// Within restricts the upcoming events to those starting in the given
+	// number of days if positive.
+	Within int
+	// From and To restrict the events to those starting in this
+	// inclusive range. Either one may be zero for an open range.
+	From, To time.Time
+	// Day restricts the events to those taking place on the day of this
+	// time if not zero.
+	Day time.Time
+	// SkipImages leaves out the images of past events.
+	SkipImages bool
+	// Locale is the locale the events are localized to instead of the
+	// request's one if not empty.
+	Locale string
+	// Search selects the events whose title, body or place contain all
+	// these space separated terms, ignoring case, if not empty.
+	Search string
+}
+
+// eventList contains the ongoing, upcoming and past events selected by
+// getEvents.
+type eventList struct {
+	// Ongoing are the events taking place now, which are neither
+	// upcoming nor past. Pinned ongoing events stay in Upcoming.
+	Ongoing        []eventCtx
+	Upcoming, Past []eventCtx
+	// OngoingCount, UpcomingCount and PastCount are the total numbers of
+	// the respective events, regardless of the limit. Past events hidden
+	// by the site's PastRetentionDays are not counted.
+	OngoingCount, UpcomingCount, PastCount int
+	// RootMissing is true if there is no node at the list's root path.
+	RootMissing bool
+	// SessionDependent is true if the selection depends on the session
+	// of the request, see sessionDependent.
+	SessionDependent bool
+	// Sources are the paths whose children have been listed.
+	Sources []string
+	// Changes is the earliest time the selection changes other than by
+	// a listed event starting or ending, i.e. when an event's visibility
+	// window opens or closes, an upcoming event enters the Within window
+	// or a past event leaves the retention.
+	// Zero if there is none.
+	Changes time.Time
+}
+
+// getEvents fetches the events of the list at the given root path and
+// selects those asked for by the given query, see selectEvents. The
+// images of the selected past events are fetched unless skipped.
+func getEvents(req *service.Request, m nodeReader, root string,
+	query eventsQuery) (*eventList, error) {
+	events, sources, missing, err := getSourceEvents(req, m, root)
+	if err != nil {
+		return nil, err
+	}
+	if missing {
+		// A list without root, e.g. an embed pointing to a removed
+		// node, is empty instead of failing the whole page.
+		return &eventList{RootMissing: true, Sources: sources}, nil
+	}
+	ret := selectEvents(req, events, query)
+	ret.Sources = sources
+	for i := 0; i < len(ret.Past) && !query.SkipImages; i++ {
+		ret.Past[i].Images, err = getImages(m, req.Site, ret.Past[i].Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// selectEvents selects the given events of a list as asked for by the
+// given query and visible to the user of the given request, sorts them
+// and splits them into ongoing, upcoming and past ones.
+func selectEvents(req *service.Request, events []*service.Node,
+	query eventsQuery) *eventList {
+	location := siteLocation(req.Site)
+	changes := visibilityChange(events, time.Now())
+	personal := sessionDependent(events, time.Now())
+	locale := query.Locale
+	if locale == "" {
+		locale = requestLocale(req)
+	}
+	events = localizeEvents(events, locale)
+	events = expandRecurrences(visibleEvents(req, events), location)
+	if query.Category != "" {
+		events = filterEvents(events, func(event *service.Node) bool {
+			return strings.EqualFold(getText(event, "events.Category"),
+				query.Category)
+		})
+	}
+	if terms := strings.Fields(strings.ToLower(query.Search)); len(terms) > 0 {
+		events = filterEvents(events, func(event *service.Node) bool {
+			return matchesTerms(event, terms)
+		})
+	}
+	if query.FeaturedOnly {
+		events = filterEvents(events, func(event *service.Node) bool {
+			return getBool(event, "events.Featured")
+		})
+	}
+	if query.HideCancelled {
+		events = filterEvents(events, func(event *service.Node) bool {
+			return eventCtx{Node: event}.Status() != statusCancelled
+		})
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		events = filterEvents(events, func(event *service.Node) bool {
+			start := startTime(event)
+			return !start.Before(query.From) &&
+				(query.To.IsZero() || !start.After(query.To))
+		})
+	}
+	if !query.Day.IsZero() {
+		events = filterEvents(events, func(event *service.Node) bool {
+			return eventCtx{Node: event, location: location}.OccursOn(query.Day)
+		})
+	}
+	sort.Sort(&nodes.Sorter{events, byStart})
+	var pinned []eventCtx
+	if !query.PastOnly {
+		events, pinned = takePinned(events,
+			getSiteSettings(req.Site).UnpinPastEvents, location)
+	}
+
+	var cutoff time.Time
+	retention := getSiteSettings(req.Site).PastRetentionDays
+	if retention > 0 {
+		cutoff = time.Now().AddDate(0, 0, -retention)
+	}
+	var ongoing, upcoming, past []eventCtx
+	for _, node := range events {
+		event := eventCtx{Node: node, location: location}
+		switch {
+		case event.Ongoing():
+			ongoing = append(ongoing, event)
+		case event.Upcoming():
+			upcoming = append(upcoming, event)
+		case event.End().Before(cutoff):
+			// Past events beyond the retention are hidden.
+		default:
+			past = append(past, event)
+		}
+	}
+	// The events are sorted by ascending start time.
+	switch query.Order {
+	case orderAsc:
+	case orderDesc:
+		reverseEvents(pinned)
+		reverseEvents(ongoing)
+		reverseEvents(upcoming)
+		reverseEvents(past)
+	default:
+		reverseEvents(past)
+	}
+	if query.FeaturedOnTop {
+		featuredFirst(upcoming)
+	}
+	ret := &eventList{
+		Ongoing:  ongoing,
+		Upcoming: append(pinned, upcoming...),
+		Past:     past,
+		Changes:  changes,
+	}
+	ret.SessionDependent = personal
+	// The classes of the events mark those starting soon.
+	soon := soonWindow(req.Site)
+	for _, list := range [][]eventCtx{ret.Ongoing, ret.Upcoming, ret.Past} {
+		for i := range list {
+			list[i].soon = soon
+		}
+	}
+	for i := 0; i < len(past) && retention > 0; i++ {
+		ret.Changes = earliest(ret.Changes,
+			past[i].End().AddDate(0, 0, retention))
+	}
+	if query.Within > 0 {
+		// Pinned ongoing events start before now and are kept.
+		window := time.Duration(query.Within) * 24 * time.Hour
+		end := time.Now().Add(window)
+		var windowed []eventCtx
+		for _, event := range ret.Upcoming {
+			start := event.Start()
+			if !start.After(end) {
+				windowed = append(windowed, event)
+			} else {
+				ret.Changes = earliest(ret.Changes, start.Add(-window))
+			}
+		}
+		ret.Upcoming = windowed
+	}
+	ret.OngoingCount = len(ret.Ongoing)
+	ret.UpcomingCount, ret.PastCount = len(ret.Upcoming), len(ret.Past)
+	if query.PastOnly {
+		ret.Ongoing, ret.Upcoming = nil, nil
+	}
+	if query.UpcomingOnly {
+		ret.Past = nil
+	}
+	if query.OngoingOnly {
+		ret.Upcoming, ret.Past = nil, nil
+	}
+	if query.Offset >= len(ret.Past) {
+		ret.Past = nil
+	} else {
+		ret.Past = ret.Past[query.Offset:]
+	}
+	if query.Limit != -1 {
+		if len(ret.Upcoming) > query.Limit {
+			ret.Upcoming = ret.Upcoming[:query.Limit]
+		}
+		if len(ret.Past) > query.Limit {
+			ret.Past = ret.Past[:query.Limit]
+		}
+	}
+	return ret
+}
+
+// timeSpan returns the earliest start and the latest end of the given
+// events, or nil if there are no events.
+func timeSpan(events ...[]eventCtx) (*time.Time, *time.Time) {
+	var first, last *time.Time
+	for _, list := range events {
+		for _, event := range list {
+			start, end := event.Start(), event.End()
+			if first == nil || start.Before(*first) {
+				first = &start
+			}
+			if last == nil || end.After(*last) {
+				last = &end
+			}
+		}
+	}
+	return first, last
+}
+
+// nextTransition returns the earliest start, end or registration
+// deadline of the given events after now, i.e. the time at which a list
+// of them changes. It returns the zero time if all events are over.
+func nextTransition(now time.Time, events ...[]eventCtx) time.Time {
+	var next time.Time
+	for _, list := range events {
+		for _, event := range list {
+			for _, t := range []time.Time{event.Start(), event.End(),
+				event.RegistrationDeadline()} {
+				if t.After(now) && (next.IsZero() || t.Before(next)) {
+					next = t
+				}
+			}
+		}
+	}
+	return next
+}
+
+// nextEvent returns the soonest of the given events which has not started
+// yet or nil if there is none. Pinned and featured events, which may
+// come first in lists, are taken into account by their start like any
+// other.
+func nextEvent(events []eventCtx) *eventCtx {
+	var next *eventCtx
+	now := time.Now()
+	for i, event := range events {
+		if event.Start().After(now) &&
+			(next == nil || byStart(event.Node, next.Node)) {
+			next = &events[i]
+		}
+	}
+	return next
+}
+
+// earliest returns the earliest of the given times which are not zero,
+// or the zero time if all are zero.
+func earliest(times ...time.Time) time.Time {
+	var ret time.Time
+	for _, t := range times {
+		if !t.IsZero() && (ret.IsZero() || t.Before(ret)) {
+			ret = t
+		}
+	}
+	return ret
+}
+
+// eventsTab describes a tab of an events list showing either the
+// upcoming, the ongoing or the past events.
+type eventsTab struct {
+	Id     string
+	URL    string
+	Count  int
+	Active bool
+}
+
+// getTabs returns the upcoming and past tabs of the list at the given
+// path and, if there are ongoing events, the ongoing tab. The active tab
+// is derived from the query, the URLs keep all other query parameters.
+func getTabs(path string, query url.Values, events *eventList) []eventsTab {
+	tabs := []eventsTab{
+		{Id: "upcoming",
+			Count: events.OngoingCount + events.UpcomingCount},
+		{Id: "past", Count: events.PastCount},
+	}
+	upcoming, past := len(query["upcoming"]) > 0, len(query["past"]) > 0
+	ongoing := len(query["ongoing"]) > 0
+	tabs[0].Active = upcoming && !past
+	tabs[1].Active = past && !upcoming
+	if events.OngoingCount > 0 {
+		tabs = append(tabs, eventsTab{Id: "ongoing",
+			Count: events.OngoingCount, Active: ongoing && !upcoming && !past})
+	}
+	for i := range tabs {
+		tabQuery := url.Values{}
+		for key, values := range query {
+			if key != "upcoming" && key != "past" && key != "ongoing" {
+				tabQuery[key] = values
+			}
+		}
+		tabQuery.Set(tabs[i].Id, "1")
+		tabs[i].URL = path + "/?" + tabQuery.Encode()
+	}
+	return tabs
+}
+
+// flagParams are the list parameters applying if present, whatever
+// their value.
+var flagParams = map[string]bool{"past": true, "upcoming": true,
+	"ongoing": true, "featured": true, "featured_first": true,
+	"isolated": true}
+
+// normalizeQuery returns the given list query of the given site without
+// parameters having no effect, so equal lists get equal links and cache
+// keys. Only the first value of each parameter is kept as the others
+// are ignored. Flags become 1, empty values, invalid orders, defaults
+// like the first page or offset zero and the site's default limit are
+// dropped. The day parameter is kept even if empty as it then means
+// today. Encoding the query orders the parameters by name.
+func normalizeQuery(site string, query url.Values) url.Values {
+	ret := url.Values{}
+	for key, values := range query {
+		if len(values) == 0 {
+			continue
+		}
+		value := values[0]
+		if key == "q" || key == "category" {
+			value = strings.TrimSpace(value)
+		}
+		switch {
+		case flagParams[key]:
+			value = "1"
+		case key == "day":
+		case value == "":
+			continue
+		case key == "page":
+			if page, err := strconv.Atoi(value); err != nil || page <= 1 {
+				continue
+			}
+		case key == "offset":
+			if offset, err := strconv.Atoi(value); err != nil || offset <= 0 {
+				continue
+			}
+		case key == "order":
+			if value != orderAsc && value != orderDesc {
+				continue
+			}
+		case key == "limit":
+			// Printed programs are unlimited without a limit.
+			if query.Get("view") != "print" &&
+				parseLimit(site, value) == parseLimit(site, "") {
+				continue
+			}
+		}
+		ret.Set(key, value)
+	}
+	return ret
+}
+
+// pageURL returns the URL of the list at the given path showing the past
+// events starting at the given offset. The other query parameters, e.g.
+// filters, are kept.
+func pageURL(path string, query url.Values, offset int) string {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		if key != "offset" && key != "page" {
+			pageQuery[key] = values
+		}
+	}
+	if offset > 0 {
+		pageQuery.Set("offset", strconv.Itoa(offset))
+	}
+	if len(pageQuery) == 0 {
+		return path + "/"
+	}
+	return path + "/?" + pageQuery.Encode()
+}
+
+// feedFormats are the formats of the feeds of events lists.
+var feedFormats = []string{"ics", "atom", "json"}
+
+// feedURLs maps the feed formats and webcal, which subscribes to the ICS
+// feed, to the absolute URLs of the feeds of the list at the given path
+// of the given site. The filters of the query are kept, its pagination
+// and view are dropped.
+func feedURLs(site, path string, query url.Values) map[string]string {
+	feedQuery := url.Values{}
+	for key, values := range query {
+		switch key {
+		case "format", "view", "offset", "page", "month":
+		default:
+			feedQuery[key] = values
+		}
+	}
+	ret := make(map[string]string)
+	for _, format := range feedFormats {
+		feedQuery.Set("format", format)
+		ret[format] = siteURL(site, path+"/?"+feedQuery.Encode())
+	}
+	ret["webcal"] = webcalURL(ret["ics"])
+	return ret
+}
+
+// pageLinks returns the absolute URLs of the current, the previous and the
+// next page of past events of the list at the given path, given the offset
+// of the current page, the page size and the number of past events. The
+// previous and next URLs are empty on the first and last page.
+func pageLinks(site, path string, query url.Values, offset, limit,
+	count int) (canonical, prev, next string) {
+	canonical = siteURL(site, pageURL(path, query, offset))
+	if offset > 0 {
+		prevOffset := offset - limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		prev = siteURL(site, pageURL(path, query, prevOffset))
+	}
+	if offset+limit < count {
+		next = siteURL(site, pageURL(path, query, offset+limit))
+	}
+	return
+}
+
+// eventsData contains the data of an events list independent of the
+// output format.
+type eventsData struct {
+	*eventList
+	eventsQuery
+	Tabs               []eventsTab
+	ListStart, ListEnd *time.Time
+	// HasPrevPage and HasNextPage tell if there are more past events
+	// before or after the current window, starting at PrevOffset and
+	// NextOffset respectively. PrevPageURL and NextPageURL are the
+	// absolute URLs of these pages and CanonicalURL the one of the
+	// current page, see pageLinks.
+	HasPrevPage, HasNextPage bool
+	PrevOffset, NextOffset   int
+	PrevPageURL, NextPageURL string
+	CanonicalURL             string
+	// View is the requested view of the list, e.g. "by-venue".
+	View string
+}
+
+// parseLimit returns the limit of events given by the limit parameter
+// of a request to the given site, or -1 if unlimited. Positive limits
+// are honored and zero or negative ones mean unlimited. Without a
+// parameter or with a malformed one, the site's DefaultLimit applies.
+// Any limit, including unlimited, is capped at the site's MaxLimit.
+func parseLimit(site, param string) int {
+	config := getSiteSettings(site)
+	limit := -1
+	if config.DefaultLimit > 0 {
+		limit = config.DefaultLimit
+	}
+	if value, err := strconv.Atoi(strings.TrimSpace(param)); err == nil {
+		limit = value
+		if limit <= 0 {
+			limit = -1
+		}
+	}
+	if config.MaxLimit > 0 && (limit == -1 || limit > config.MaxLimit) {
+		limit = config.MaxLimit
+	}
+	return limit
+}
+
+// parseDate parses the given RFC 3339 date time or YYYY-MM-DD date,
+// which is interpreted in the given time zone. If endOfDate is true,
+// dates mean the last instant of the day.
+func parseDate(value string, location *time.Location,
+	endOfDate bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"Invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	if endOfDate {
+		t = endOfDay(t).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// parseEventsQuery returns the events data of a list of the given site
+// with the selection and view given by the query parameters but without
+// any events.
+func parseEventsQuery(site string, query url.Values) (*eventsData, error) {
+	data := &eventsData{
+		eventsQuery: eventsQuery{
+			PastOnly:      len(query["past"]) > 0,
+			UpcomingOnly:  len(query["upcoming"]) > 0,
+			OngoingOnly:   len(query["ongoing"]) > 0,
+			FeaturedOnTop: len(query["featured_first"]) > 0,
+			FeaturedOnly:  len(query["featured"]) > 0,
+			Search:        strings.TrimSpace(query.Get("q")),
+			Limit:         parseLimit(site, query.Get("limit")),
+			Category:      strings.TrimSpace(query.Get("category")),
+		},
+		View: query.Get("view"),
+	}
+	if data.View == "print" && query.Get("limit") == "" {
+		// Printed programs list all events unless asked otherwise.
+		data.Limit = -1
+	}
+	for _, format := range feedFormats {
+		if query.Get("format") == format {
+			data.Locale = feedLocale(site, query.Get("lang"))
+		}
+	}
+	switch query.Get("format") {
+	case "ics", "atom", "csv":
+		// Feeds and exports don't show images.
+		data.SkipImages = true
+	case "":
+		data.HideCancelled = getSiteSettings(site).HideCancelled
+	}
+	if data.OngoingOnly && (data.PastOnly || data.UpcomingOnly) {
+		// Ongoing events are part of the upcoming ones anyway.
+		data.OngoingOnly = false
+	}
+	if data.PastOnly && data.UpcomingOnly {
+		// Asking for both past and upcoming events means all events.
+		data.PastOnly, data.UpcomingOnly = false, false
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil &&
+		offset > 0 {
+		data.Offset = offset
+	} else if page, err := strconv.Atoi(query.Get("page")); err == nil &&
+		page > 1 && data.Limit != -1 {
+		data.Offset = (page - 1) * data.Limit
+	}
+	switch order := query.Get("order"); order {
+	case orderAsc, orderDesc:
+		data.Order = order
+	}
+	if within, err := strconv.Atoi(query.Get("within")); err == nil &&
+		within > 0 {
+		data.Within = within
+	}
+	var err error
+	location := siteLocation(site)
+	if from := query.Get("from"); from != "" {
+		if data.From, err = parseDate(from, location, false); err != nil {
+			return nil, badRequest("Could not parse from parameter: %v",
+				err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if data.To, err = parseDate(to, location, true); err != nil {
+			return nil, badRequest("Could not parse to parameter: %v", err)
+		}
+	}
+	if _, ok := query["day"]; ok {
+		// Kiosk displays ask for today's events with an empty day.
+		day := time.Now()
+		if value := query.Get("day"); value != "" {
+			if day, err = parseDate(value, location, false); err != nil {
+				return nil, badRequest("Could not parse day parameter: %v",
+					err)
+			}
+		}
+		data.Day = startOfDay(day.In(location))
+	}
+	if !data.From.IsZero() && !data.To.IsZero() && data.To.Before(data.From) {
+		return nil, badRequest("Invalid date range: to is before from")
+	}
+	return data, nil
+}
+
+// inheritedParams are the parameters of the embedding page's query
+// applying to embedded lists, see listTarget.
+var inheritedParams = []string{"category", "q", "from", "to", "day",
+	"within", "page", "offset", "lang"}
+
+// listTarget returns the root path and the query of the list requested
+// at the given path with the given query or, if embedded, of the given
+// embed. The events are the children of the list node, which is the
+// embedded node for embedded lists. Embedded lists use the query of
+// their embed URI merged with the filters of the embedding page, see
+// inheritedParams, unless set in the URI. Embeds with the isolated
+// parameter, e.g. featured event widgets, only use their URI's query.
+func listTarget(nodePath string, query url.Values,
+	embed *service.EmbedNode) (string, url.Values, error) {
+	if embed == nil {
+		return nodePath, query, nil
+	}
+	target, err := url.Parse(embed.URI)
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not parse embed URI: %v", err)
+	}
+	embedQuery := target.Query()
+	if _, isolated := embedQuery["isolated"]; !isolated {
+		for _, key := range inheritedParams {
+			if _, ok := embedQuery[key]; !ok && len(query[key]) > 0 {
+				embedQuery[key] = query[key]
+			}
+		}
+	}
+	return path.Clean(target.Path), embedQuery, nil
+}
+
+// buildEventsData gathers the events of the list at the given root path
+// according to the given query.
+func buildEventsData(req *service.Request, m nodeReader, root string,
+	query url.Values) (*eventsData, *service.CacheMods, error) {
+	data, err := parseEventsQuery(req.Site, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	data.eventList, err = getEvents(req, m, root, data.eventsQuery)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not retrieve events: %v", err)
+	}
+	if !data.UpcomingOnly && !data.OngoingOnly && data.Limit != -1 {
+		data.HasPrevPage = data.Offset > 0
+		data.PrevOffset = data.Offset - data.Limit
+		if data.PrevOffset < 0 {
+			data.PrevOffset = 0
+		}
+		data.NextOffset = data.Offset + len(data.Past)
+		data.HasNextPage = data.NextOffset < data.PastCount
+		data.CanonicalURL, data.PrevPageURL, data.NextPageURL = pageLinks(
+			req.Site, root, query, data.Offset, data.Limit, data.PastCount)
+	}
+	data.Tabs = getTabs(root, query, data.eventList)
+	data.ListStart, data.ListEnd = timeSpan(data.Ongoing, data.Upcoming,
+		data.Past)
+
+	// Feeds and exports don't read the images of the events.
+	descend := descendImages
+	if data.SkipImages {
+		descend = descendEvents
+	}
+	mods := &service.CacheMods{
+		Deps: sourceDeps(root, data.Sources, descend),
+		Expire: earliest(nextTransition(time.Now(), data.Ongoing,
+			data.Upcoming, data.Past), data.Changes),
+	}
+	// Lists containing restricted events are not shared between
+	// visitors.
+	if data.SessionDependent {
+		mods.Expire = time.Now()
+	}
+	// Lists of today's events roll over at midnight, as do the today
+	// marks of events taking place today.
+	if end := endOfDay(data.Day); !data.Day.IsZero() &&
+		end.After(time.Now()) {
+		mods.Expire = earliest(mods.Expire, end)
+	}
+	if anyToday(data.Ongoing, data.Upcoming, data.Past) {
+		mods.Expire = earliest(mods.Expire,
+			endOfDay(time.Now().In(siteLocation(req.Site))))
+	}
+	return data, mods, nil
+}
+
+// anyToday checks if any of the given events takes place today.
+func anyToday(lists ...[]eventCtx) bool {
+	for _, list := range lists {
+		for _, event := range list {
+			if event.IsToday() {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,931 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestPageLinks(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {BaseURL: "https://example.com"}}
+	defer func() { moduleConfig.Sites = nil }()
+	query := url.Values{"past": {"1"}, "category": {"talk"}, "offset": {"10"}}
+	tests := []struct {
+		Offset                int
+		Canonical, Prev, Next string
+	}{
+		{0, "https://example.com/events/?category=talk&past=1", "",
+			"https://example.com/events/?category=talk&offset=10&past=1"},
+		{10, "https://example.com/events/?category=talk&offset=10&past=1",
+			"https://example.com/events/?category=talk&past=1",
+			"https://example.com/events/?category=talk&offset=20&past=1"},
+		{20, "https://example.com/events/?category=talk&offset=20&past=1",
+			"https://example.com/events/?category=talk&offset=10&past=1", ""},
+	}
+	for i, test := range tests {
+		canonical, prev, next := pageLinks("example", "/events", query,
+			test.Offset, 10, 25)
+		if canonical != test.Canonical || prev != test.Prev ||
+			next != test.Next {
+			t.Errorf("%d: pageLinks(%v) = %q, %q, %q, should be %q, %q, %q", i,
+				test.Offset, canonical, prev, next, test.Canonical, test.Prev,
+				test.Next)
+		}
+	}
+}
+
+func TestGetTabs(t *testing.T) {
+	events := &eventList{OngoingCount: 1, UpcomingCount: 2, PastCount: 3}
+	tests := []struct {
+		Query                   string
+		Upcoming, Past, Ongoing bool
+	}{
+		{"", false, false, false},
+		{"upcoming=1", true, false, false},
+		{"past=1", false, true, false},
+		{"ongoing=1", false, false, true},
+		{"upcoming=1&past=1", false, false, false},
+		{"upcoming=1&ongoing=1", true, false, false},
+		{"past=1&ongoing=1", false, true, false},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.Query)
+		tabs := getTabs("/events", query, events)
+		if len(tabs) != 3 {
+			t.Fatalf("getTabs(%q) returned %d tabs, should be 3", test.Query,
+				len(tabs))
+		}
+		for i, active := range []bool{test.Upcoming, test.Past, test.Ongoing} {
+			if tabs[i].Active != active {
+				t.Errorf("getTabs(%q): tab %v active is %v, should be %v",
+					test.Query, tabs[i].Id, tabs[i].Active, active)
+			}
+		}
+	}
+	query := url.Values{"category": {"talk"}, "past": {"1"}}
+	tabs := getTabs("/events", query, events)
+	for i, count := range []int{3, 3, 1} {
+		if tabs[i].Count != count {
+			t.Errorf("tab %v has count %v, should be %v", tabs[i].Id,
+				tabs[i].Count, count)
+		}
+	}
+	if got := tabs[2].URL; got != "/events/?category=talk&ongoing=1" {
+		t.Errorf("ongoing tab has URL %q", got)
+	}
+	events.OngoingCount = 0
+	if tabs := getTabs("/events", query, events); len(tabs) != 2 {
+		t.Errorf("getTabs without ongoing events returned %d tabs, should be 2",
+			len(tabs))
+	}
+}
+
+func TestCSSClasses(t *testing.T) {
+	yes := service.BoolField(true)
+	cancelled, online := service.TextField("cancelled"),
+		service.TextField("online")
+	soon := &service.DateTimeField{time.Now().Add(time.Hour)}
+	later := &service.DateTimeField{time.Now().Add(48 * time.Hour)}
+	past := &service.DateTimeField{time.Now().Add(-48 * time.Hour)}
+	tomorrow := &service.DateTimeField{time.Now().Add(10 * time.Hour)}
+	tests := []struct {
+		Fields  map[string]service.Field
+		Soon    time.Duration
+		Classes string
+	}{
+		{map[string]service.Field{"events.StartTime": later}, 2 * time.Hour,
+			"monsti-events--event-upcoming monsti-events--event-in-person"},
+		{map[string]service.Field{"events.StartTime": past}, 2 * time.Hour,
+			"monsti-events--event-past monsti-events--event-in-person"},
+		{map[string]service.Field{"events.StartTime": later,
+			"events.Status": &cancelled, "events.Featured": &yes}, 2 * time.Hour,
+			"monsti-events--event-upcoming monsti-events--event-cancelled " +
+				"monsti-events--event-featured monsti-events--event-in-person"},
+		{map[string]service.Field{"events.StartTime": later,
+			"events.EventType": &online, "events.SoldOut": &yes}, 2 * time.Hour,
+			"monsti-events--event-upcoming monsti-events--event-sold-out " +
+				"monsti-events--event-online"},
+		{map[string]service.Field{"events.StartTime": soon}, 2 * time.Hour,
+			"monsti-events--event-upcoming monsti-events--event-starts-soon " +
+				"monsti-events--event-in-person"},
+		{map[string]service.Field{"events.StartTime": tomorrow}, 2 * time.Hour,
+			"monsti-events--event-upcoming monsti-events--event-in-person"},
+		// Without a window, the default one applies.
+		{map[string]service.Field{"events.StartTime": tomorrow}, 0,
+			"monsti-events--event-upcoming monsti-events--event-starts-soon " +
+				"monsti-events--event-in-person"},
+	}
+	for i, test := range tests {
+		event := eventCtx{Node: &service.Node{Fields: test.Fields},
+			location: time.UTC, soon: test.Soon}
+		// Don't depend on the day the tests run.
+		classes := strings.Replace(event.CSSClasses(),
+			" monsti-events--event-today", "", 1)
+		if classes != test.Classes {
+			t.Errorf("%d: CSSClasses() = %q, should be %q", i, classes,
+				test.Classes)
+		}
+	}
+}
+
+func TestVisibleEvents(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {EditorRole: "editor",
+			Roles: map[string][]string{"editor": {"ed"}}}}
+	defer func() { moduleConfig.Sites = nil }()
+	yes := service.BoolField(true)
+	future := &service.DateTimeField{time.Now().Add(time.Hour)}
+	past := &service.DateTimeField{time.Now().Add(-time.Hour)}
+	public := &service.Node{Path: "/public", Fields: map[string]service.Field{}}
+	restricted := &service.Node{Path: "/restricted",
+		Fields: map[string]service.Field{"events.Restricted": &yes}}
+	scheduled := &service.Node{Path: "/scheduled",
+		Fields: map[string]service.Field{"events.VisibleFrom": future}}
+	withdrawn := &service.Node{Path: "/withdrawn",
+		Fields: map[string]service.Field{"events.VisibleUntil": past}}
+	events := []*service.Node{public, restricted, scheduled, withdrawn}
+	tests := []struct {
+		Session *service.UserSession
+		Paths   string
+	}{
+		{nil, "/public"},
+		{&service.UserSession{User: &service.User{Login: "member"}},
+			"/public /restricted"},
+		{&service.UserSession{User: &service.User{Login: "ed"}},
+			"/public /restricted /scheduled"},
+	}
+	for _, test := range tests {
+		req := &service.Request{Site: "example", Session: test.Session}
+		var paths []string
+		for _, event := range visibleEvents(req, events) {
+			paths = append(paths, event.Path)
+		}
+		if got := strings.Join(paths, " "); got != test.Paths {
+			t.Errorf("visibleEvents(%v) = %q, should be %q", test.Session,
+				got, test.Paths)
+		}
+	}
+}
+
+func TestBuildEventsDataWithdrawn(t *testing.T) {
+	now := time.Now()
+	withdrawn := testEvent("/events/withdrawn", now.Add(48*time.Hour))
+	withdrawn.Fields["events.VisibleUntil"] = &service.DateTimeField{
+		now.Add(-time.Hour)}
+	reader := newTestReader(&service.Node{Path: "/events"}, withdrawn,
+		testEvent("/events/up", now.Add(72*time.Hour)))
+	req := &service.Request{Site: "example"}
+	data, mods, err := buildEventsData(req, reader, "/events", url.Values{})
+	if err != nil {
+		t.Fatalf("buildEventsData() failed: %v", err)
+	}
+	if data.SessionDependent || eventPaths(data.Upcoming) != "/events/up" {
+		t.Errorf("buildEventsData() selected %q, session dependent: %v",
+			eventPaths(data.Upcoming), data.SessionDependent)
+	}
+	// The list changes when the remaining event starts.
+	if expire := now.Add(72 * time.Hour); !mods.Expire.Equal(expire) {
+		t.Errorf("buildEventsData() expires at %v, should be %v", mods.Expire,
+			expire)
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {DefaultLimit: 10}}
+	defer func() { moduleConfig.Sites = nil }()
+	tests := []struct {
+		Query, Normalized string
+	}{
+		{"", ""},
+		{"page=1&offset=0&category=&q=+&order=random&limit=10", ""},
+		{"past&category=+talk+&category=music&page=2", "category=talk&page=2&past=1"},
+		{"offset=20&limit=5&order=desc", "limit=5&offset=20&order=desc"},
+		{"day=&upcoming=yes", "day=&upcoming=1"},
+		{"view=print&limit=10", "limit=10&view=print"},
+		{"page=x&offset=-3", ""},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.Query)
+		if got := normalizeQuery("example", query).Encode(); got !=
+			test.Normalized {
+			t.Errorf("normalizeQuery(%q) = %q, should be %q", test.Query, got,
+				test.Normalized)
+		}
+	}
+	// Equal lists have the same canonical URL.
+	for _, raw := range []string{"page=1&category=talk",
+		"category=talk&offset=0&limit=10", "category=+talk&q="} {
+		query, _ := url.ParseQuery(raw)
+		canonical, _, _ := pageLinks("example", "/events",
+			normalizeQuery("example", query), 0, 10, 5)
+		if canonical != "http://example/events/?category=talk" {
+			t.Errorf("Canonical URL of %q is %q", raw, canonical)
+		}
+	}
+}
+
+func TestFeedURLs(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {BaseURL: "https://example.com/"}}
+	defer func() { moduleConfig.Sites = nil }()
+	query := url.Values{"category": {"talk"}, "q": {"go"}, "offset": {"10"},
+		"view": {"by-venue"}}
+	expected := map[string]string{
+		"ics":    "https://example.com/events/?category=talk&format=ics&q=go",
+		"atom":   "https://example.com/events/?category=talk&format=atom&q=go",
+		"json":   "https://example.com/events/?category=talk&format=json&q=go",
+		"webcal": "webcal://example.com/events/?category=talk&format=ics&q=go",
+	}
+	feeds := feedURLs("example", "/events", query)
+	if len(feeds) != len(expected) {
+		t.Errorf("feedURLs returned %v, should be %v", feeds, expected)
+	}
+	for format, feed := range expected {
+		if feeds[format] != feed {
+			t.Errorf("feedURLs()[%q] = %q, should be %q", format,
+				feeds[format], feed)
+		}
+	}
+}
+
+// testEvent returns an event node at the given path starting at the given
+// time and lasting one hour.
+func testEvent(path string, start time.Time) *service.Node {
+	return &service.Node{Path: path, Fields: map[string]service.Field{
+		"events.StartTime": &service.DateTimeField{start},
+		"events.EndTime":   &service.DateTimeField{start.Add(time.Hour)},
+	}}
+}
+
+// eventPaths returns the space separated paths of the given events.
+func eventPaths(events []eventCtx) string {
+	paths := make([]string, len(events))
+	for i, event := range events {
+		paths[i] = event.Path
+	}
+	return strings.Join(paths, " ")
+}
+
+func TestSelectEventsLimit(t *testing.T) {
+	now := time.Now()
+	events := []*service.Node{
+		testEvent("/past1", now.Add(-72*time.Hour)),
+		testEvent("/up2", now.Add(48*time.Hour)),
+		testEvent("/past3", now.Add(-24*time.Hour)),
+		testEvent("/ongoing", now.Add(-30*time.Minute)),
+		testEvent("/up1", now.Add(24*time.Hour)),
+		testEvent("/past2", now.Add(-48*time.Hour)),
+		testEvent("/up3", now.Add(72*time.Hour)),
+	}
+	tests := []struct {
+		Query          eventsQuery
+		Upcoming, Past string
+	}{
+		{eventsQuery{Limit: -1}, "/up1 /up2 /up3", "/past3 /past2 /past1"},
+		{eventsQuery{Limit: 2}, "/up1 /up2", "/past3 /past2"},
+		{eventsQuery{Limit: 10}, "/up1 /up2 /up3", "/past3 /past2 /past1"},
+		{eventsQuery{Limit: 2, Offset: 1}, "/up1 /up2", "/past2 /past1"},
+		{eventsQuery{Limit: 2, Offset: 2}, "/up1 /up2", "/past1"},
+		{eventsQuery{Limit: 2, Offset: 3}, "/up1 /up2", ""},
+		{eventsQuery{Limit: 2, Offset: 10}, "/up1 /up2", ""},
+		{eventsQuery{Limit: -1, Offset: 1}, "/up1 /up2 /up3", "/past2 /past1"},
+		{eventsQuery{Limit: 2, PastOnly: true}, "", "/past3 /past2"},
+		{eventsQuery{Limit: 2, UpcomingOnly: true}, "/up1 /up2", ""},
+		{eventsQuery{Limit: 2, OngoingOnly: true}, "", ""},
+	}
+	req := &service.Request{Site: "example"}
+	for i, test := range tests {
+		list := selectEvents(req, events, test.Query)
+		if got := eventPaths(list.Upcoming); got != test.Upcoming {
+			t.Errorf("%d: upcoming events are %q, should be %q", i, got,
+				test.Upcoming)
+		}
+		if got := eventPaths(list.Past); got != test.Past {
+			t.Errorf("%d: past events are %q, should be %q", i, got, test.Past)
+		}
+		ongoing := "/ongoing"
+		if test.Query.PastOnly {
+			ongoing = ""
+		}
+		if got := eventPaths(list.Ongoing); got != ongoing {
+			t.Errorf("%d: ongoing events are %q, should be %q", i, got,
+				ongoing)
+		}
+		if list.OngoingCount != 1 || list.UpcomingCount != 3 ||
+			list.PastCount != 3 {
+			t.Errorf("%d: counts are %v, %v, %v, should be 1, 3, 3", i,
+				list.OngoingCount, list.UpcomingCount, list.PastCount)
+		}
+	}
+}
+
+func TestSelectEventsOnlyPastOrUpcoming(t *testing.T) {
+	now := time.Now()
+	past := []*service.Node{
+		testEvent("/past1", now.Add(-48*time.Hour)),
+		testEvent("/past2", now.Add(-24*time.Hour)),
+	}
+	upcoming := []*service.Node{
+		testEvent("/up1", now.Add(24*time.Hour)),
+		testEvent("/up2", now.Add(48*time.Hour)),
+	}
+	req := &service.Request{Site: "example"}
+	list := selectEvents(req, past, eventsQuery{Limit: 1})
+	if len(list.Upcoming) != 0 || eventPaths(list.Past) != "/past2" ||
+		list.UpcomingCount != 0 || list.PastCount != 2 {
+		t.Errorf("past events only: got %q, %q (%v, %v)",
+			eventPaths(list.Upcoming), eventPaths(list.Past),
+			list.UpcomingCount, list.PastCount)
+	}
+	list = selectEvents(req, upcoming, eventsQuery{Limit: 1, Offset: 1})
+	if eventPaths(list.Upcoming) != "/up1" || len(list.Past) != 0 ||
+		list.UpcomingCount != 2 || list.PastCount != 0 {
+		t.Errorf("upcoming events only: got %q, %q (%v, %v)",
+			eventPaths(list.Upcoming), eventPaths(list.Past),
+			list.UpcomingCount, list.PastCount)
+	}
+	if list := selectEvents(req, nil, eventsQuery{Limit: 2}); len(
+		list.Upcoming)+len(list.Past)+len(list.Ongoing) != 0 {
+		t.Errorf("no events: got %+v", list)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"default": {DefaultLimit: 5},
+		"max":     {DefaultLimit: 5, MaxLimit: 20},
+	}
+	defer func() { moduleConfig.Sites = nil }()
+	tests := []struct {
+		Site, Param string
+		Limit       int
+	}{
+		{"example", "", -1},
+		{"example", "3", 3},
+		{"example", " 3 ", 3},
+		{"example", "0", -1},
+		{"example", "-5", -1},
+		{"example", "abc", -1},
+		{"default", "", 5},
+		{"default", "abc", 5},
+		{"default", "8", 8},
+		{"default", "0", -1},
+		{"max", "", 5},
+		{"max", "8", 8},
+		{"max", "50", 20},
+		{"max", "0", 20},
+		{"max", "-1", 20},
+	}
+	for _, test := range tests {
+		if limit := parseLimit(test.Site, test.Param); limit != test.Limit {
+			t.Errorf("parseLimit(%q, %q) = %v, should be %v", test.Site,
+				test.Param, limit, test.Limit)
+		}
+	}
+}
+
+func TestSelectEventsFeaturedFirst(t *testing.T) {
+	now := time.Now()
+	yes := service.BoolField(true)
+	events := []*service.Node{
+		testEvent("/up1", now.Add(24*time.Hour)),
+		testEvent("/up2", now.Add(48*time.Hour)),
+		testEvent("/up3", now.Add(72*time.Hour)),
+		testEvent("/up4", now.Add(96*time.Hour)),
+	}
+	events[1].Fields["events.Featured"] = &yes
+	events[3].Fields["events.Featured"] = &yes
+	tests := []struct {
+		Query    eventsQuery
+		Upcoming string
+	}{
+		{eventsQuery{Limit: -1}, "/up1 /up2 /up3 /up4"},
+		{eventsQuery{Limit: -1, FeaturedOnTop: true}, "/up2 /up4 /up1 /up3"},
+		{eventsQuery{Limit: 3, FeaturedOnTop: true}, "/up2 /up4 /up1"},
+		{eventsQuery{Limit: 1, FeaturedOnTop: true}, "/up2"},
+		{eventsQuery{Limit: -1, FeaturedOnly: true}, "/up2 /up4"},
+	}
+	req := &service.Request{Site: "example"}
+	for i, test := range tests {
+		list := selectEvents(req, events, test.Query)
+		if got := eventPaths(list.Upcoming); got != test.Upcoming {
+			t.Errorf("%d: upcoming events are %q, should be %q", i, got,
+				test.Upcoming)
+		}
+	}
+}
+
+func TestSelectEventsPinned(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"unpin": {UnpinPastEvents: true}}
+	defer func() { moduleConfig.Sites = nil }()
+	now := time.Now()
+	yes := service.BoolField(true)
+	events := []*service.Node{
+		testEvent("/past", now.Add(-24*time.Hour)),
+		testEvent("/pinned-past", now.Add(-48*time.Hour)),
+		testEvent("/up1", now.Add(24*time.Hour)),
+		testEvent("/featured", now.Add(48*time.Hour)),
+		testEvent("/pinned", now.Add(72*time.Hour)),
+	}
+	events[1].Fields["events.Pinned"] = &yes
+	events[3].Fields["events.Featured"] = &yes
+	events[4].Fields["events.Pinned"] = &yes
+	tests := []struct {
+		Site           string
+		Query          eventsQuery
+		Upcoming, Past string
+	}{
+		{"example", eventsQuery{Limit: -1},
+			"/pinned-past /pinned /up1 /featured", "/past"},
+		{"example", eventsQuery{Limit: -1, FeaturedOnTop: true},
+			"/pinned-past /pinned /featured /up1", "/past"},
+		{"example", eventsQuery{Limit: 1}, "/pinned-past", "/past"},
+		{"example", eventsQuery{Limit: -1, PastOnly: true}, "",
+			"/past /pinned-past"},
+		{"unpin", eventsQuery{Limit: -1}, "/pinned /up1 /featured",
+			"/past /pinned-past"},
+	}
+	for i, test := range tests {
+		req := &service.Request{Site: test.Site}
+		list := selectEvents(req, events, test.Query)
+		if got := eventPaths(list.Upcoming); got != test.Upcoming {
+			t.Errorf("%d: upcoming events are %q, should be %q", i, got,
+				test.Upcoming)
+		}
+		if got := eventPaths(list.Past); got != test.Past {
+			t.Errorf("%d: past events are %q, should be %q", i, got, test.Past)
+		}
+	}
+}
+
+func TestSelectEventsOrder(t *testing.T) {
+	now := time.Now()
+	events := []*service.Node{
+		testEvent("/past1", now.Add(-48*time.Hour)),
+		testEvent("/up2", now.Add(48*time.Hour)),
+		testEvent("/past2", now.Add(-24*time.Hour)),
+		testEvent("/up1", now.Add(24*time.Hour)),
+	}
+	tests := []struct {
+		Order          string
+		Upcoming, Past string
+	}{
+		{"", "/up1 /up2", "/past2 /past1"},
+		{orderAsc, "/up1 /up2", "/past1 /past2"},
+		{orderDesc, "/up2 /up1", "/past2 /past1"},
+	}
+	req := &service.Request{Site: "example"}
+	for _, test := range tests {
+		list := selectEvents(req, events,
+			eventsQuery{Limit: -1, Order: test.Order})
+		if got := eventPaths(list.Upcoming); got != test.Upcoming {
+			t.Errorf("order %q: upcoming events are %q, should be %q",
+				test.Order, got, test.Upcoming)
+		}
+		if got := eventPaths(list.Past); got != test.Past {
+			t.Errorf("order %q: past events are %q, should be %q", test.Order,
+				got, test.Past)
+		}
+	}
+}
+
+func TestSelectEventsSameStart(t *testing.T) {
+	start := time.Now().Add(24 * time.Hour)
+	events := []*service.Node{
+		testEvent("/c", start), testEvent("/a", start), testEvent("/b", start),
+	}
+	req := &service.Request{Site: "example"}
+	for i := 0; i < len(events); i++ {
+		// Rotate the given events, which must not change the order.
+		rotated := append(append([]*service.Node{}, events[i:]...),
+			events[:i]...)
+		list := selectEvents(req, rotated, eventsQuery{Limit: -1})
+		if got := eventPaths(list.Upcoming); got != "/a /b /c" {
+			t.Errorf("%d: upcoming events are %q, should be %q", i, got,
+				"/a /b /c")
+		}
+	}
+}
+
+func TestParseEventsQueryFlags(t *testing.T) {
+	tests := []struct {
+		Query                           string
+		PastOnly, UpcomingOnly, Ongoing bool
+	}{
+		{"", false, false, false},
+		{"past=1", true, false, false},
+		{"upcoming=1", false, true, false},
+		{"ongoing=1", false, false, true},
+		{"past=1&upcoming=1", false, false, false},
+		{"past&upcoming", false, false, false},
+		{"past=1&ongoing=1", true, false, false},
+		{"upcoming=1&ongoing=1", false, true, false},
+		{"past=1&upcoming=1&ongoing=1", false, false, false},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.Query)
+		data, err := parseEventsQuery("example", query)
+		if err != nil {
+			t.Fatalf("parseEventsQuery(%q) failed: %v", test.Query, err)
+		}
+		if data.PastOnly != test.PastOnly ||
+			data.UpcomingOnly != test.UpcomingOnly ||
+			data.OngoingOnly != test.Ongoing {
+			t.Errorf("parseEventsQuery(%q) selects past %v, upcoming %v, "+
+				"ongoing %v, should be %v, %v, %v", test.Query, data.PastOnly,
+				data.UpcomingOnly, data.OngoingOnly, test.PastOnly,
+				test.UpcomingOnly, test.Ongoing)
+		}
+	}
+	now := time.Now()
+	events := []*service.Node{
+		testEvent("/past", now.Add(-24*time.Hour)),
+		testEvent("/up", now.Add(24*time.Hour)),
+	}
+	query, _ := url.ParseQuery("past=1&upcoming=1")
+	data, _ := parseEventsQuery("example", query)
+	list := selectEvents(&service.Request{Site: "example"}, events,
+		data.eventsQuery)
+	if eventPaths(list.Upcoming) != "/up" || eventPaths(list.Past) != "/past" {
+		t.Errorf("both flags select %q and %q, should be all events",
+			eventPaths(list.Upcoming), eventPaths(list.Past))
+	}
+}
+
+func TestTimeSpan(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Could not load time zone: %v", err)
+	}
+	start := time.Date(2015, 5, 1, 18, 0, 0, 0, time.UTC)
+	event := func(path string, days int) eventCtx {
+		return eventCtx{Node: testEvent(path, start.AddDate(0, 0, days)),
+			location: berlin}
+	}
+	first, last := timeSpan([]eventCtx{event("/b", 30), event("/a", 0)}, nil,
+		[]eventCtx{event("/c", 120)})
+	if first == nil || !first.Equal(start) || first.Location() != berlin {
+		t.Errorf("timeSpan starts at %v, should be %v in %v", first, start,
+			berlin)
+	}
+	end := start.AddDate(0, 0, 120).Add(time.Hour)
+	if last == nil || !last.Equal(end) {
+		t.Errorf("timeSpan ends at %v, should be %v", last, end)
+	}
+	if first, last := timeSpan(nil, nil); first != nil || last != nil {
+		t.Errorf("timeSpan of no events is %v, %v, should be nil", first, last)
+	}
+}
+
+func TestNextTransition(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	event := func(path string, start time.Time) eventCtx {
+		return eventCtx{Node: testEvent(path, start), location: time.UTC}
+	}
+	deadline := event("/deadline", now.Add(5*time.Hour))
+	deadline.Fields["events.RegistrationDeadline"] = &service.DateTimeField{
+		now.Add(2 * time.Hour)}
+	tests := []struct {
+		Events []eventCtx
+		Next   time.Time
+	}{
+		{nil, time.Time{}},
+		{[]eventCtx{event("/past", now.Add(-3*time.Hour))}, time.Time{}},
+		{[]eventCtx{event("/ongoing", now.Add(-30*time.Minute)),
+			event("/upcoming", now.Add(time.Hour))}, now.Add(30 * time.Minute)},
+		{[]eventCtx{event("/later", now.Add(4*time.Hour)),
+			event("/upcoming", now.Add(3*time.Hour))}, now.Add(3 * time.Hour)},
+		{[]eventCtx{deadline}, now.Add(2 * time.Hour)},
+		{[]eventCtx{event("/now", now)}, now.Add(time.Hour)},
+	}
+	for i, test := range tests {
+		if next := nextTransition(now, test.Events); !next.Equal(test.Next) {
+			t.Errorf("%d: nextTransition() = %v, should be %v", i, next,
+				test.Next)
+		}
+	}
+	ongoing := []eventCtx{event("/ongoing", now.Add(-30*time.Minute))}
+	upcoming := []eventCtx{event("/upcoming", now.Add(10*time.Minute))}
+	if next := nextTransition(now, ongoing, upcoming); !next.Equal(
+		now.Add(10 * time.Minute)) {
+		t.Errorf("nextTransition() of several lists = %v, should be %v", next,
+			now.Add(10*time.Minute))
+	}
+}
+
+func TestRelatedPaths(t *testing.T) {
+	event := func(path, refs string) *service.Node {
+		field := service.TextField(refs)
+		return &service.Node{Path: path,
+			Fields: map[string]service.Field{"events.RelatedEvents": &field}}
+	}
+	tests := []struct {
+		Event *service.Node
+		Paths string
+	}{
+		{&service.Node{Path: "/events/a"}, ""},
+		{event("/events/a", "b, /talks/c\n../events/d"),
+			"/events/b /talks/c /events/d"},
+		{event("/events/a", "a"), ""},
+		{event("/events/a", "/events/a/ ./a /events/b"), "/events/b"},
+		{event("/events/a", "b /events/b ./b"), "/events/b"},
+		// A cycle of two events just references the other one each.
+		{event("/events/a", "b"), "/events/b"},
+		{event("/events/b", "a"), "/events/a"},
+	}
+	for i, test := range tests {
+		if got := strings.Join(relatedPaths(test.Event), " "); got !=
+			test.Paths {
+			t.Errorf("%d: relatedPaths() = %q, should be %q", i, got,
+				test.Paths)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	start := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	duration := service.TextField("PT2H")
+	tests := []struct {
+		End      time.Time
+		Duration service.Field
+		Expected time.Time
+	}{
+		{time.Time{}, nil, start},
+		{start.Add(time.Hour), nil, start.Add(time.Hour)},
+		// Zero length events are valid.
+		{start, nil, start},
+		{start.Add(-time.Hour), nil, start},
+		{start.Add(-time.Hour), &duration, start.Add(2 * time.Hour)},
+		{time.Time{}, &duration, start.Add(2 * time.Hour)},
+	}
+	for i, test := range tests {
+		node := &service.Node{Fields: map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{start}}}
+		if !test.End.IsZero() {
+			node.Fields["events.EndTime"] = &service.DateTimeField{test.End}
+		}
+		if test.Duration != nil {
+			node.Fields["events.Duration"] = test.Duration
+		}
+		end := eventCtx{Node: node, location: time.UTC}.End()
+		if !end.Equal(test.Expected) {
+			t.Errorf("%d: End() = %v, should be %v", i, end, test.Expected)
+		}
+		invalid := !test.End.IsZero() && test.End.Before(start)
+		issues := strings.Join(validateEvent(node, nil, start), " ")
+		if strings.Contains(issues, issueEndBeforeStart) != invalid {
+			t.Errorf("%d: issues are %q, end before start should be %v", i,
+				issues, invalid)
+		}
+	}
+}
+
+func TestRestrictedEvents(t *testing.T) {
+	yes := service.BoolField(true)
+	start := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	public := testEvent("/events/public", start)
+	restricted := testEvent("/events/restricted", start)
+	restricted.Fields["events.Restricted"] = &yes
+	reader := newTestReader(&service.Node{Path: "/events"}, public,
+		restricted)
+	tests := []struct {
+		Session    *service.UserSession
+		Accessible bool
+	}{
+		{nil, false},
+		{&service.UserSession{}, false},
+		{&service.UserSession{User: &service.User{Login: "member"}}, true},
+	}
+	for _, test := range tests {
+		req := &service.Request{Site: "example", Session: test.Session}
+		if !accessible(req, public) ||
+			accessible(req, restricted) != test.Accessible {
+			t.Errorf("accessible(%v) of restricted event is %v, should be %v",
+				test.Session, !test.Accessible, test.Accessible)
+		}
+		list, err := getEvents(req, reader, "/events", eventsQuery{Limit: -1})
+		if err != nil {
+			t.Fatalf("getEvents() failed: %v", err)
+		}
+		paths := "/events/public"
+		if test.Accessible {
+			paths = "/events/restricted /events/public"
+		}
+		if got := eventPaths(list.Past); got != paths {
+			t.Errorf("getEvents(%v) = %q, should be %q", test.Session, got,
+				paths)
+		}
+		feed := string(renderICal("example", 0, list.Past))
+		if strings.Contains(feed, "/events/restricted") != test.Accessible {
+			t.Errorf("feed for %v contains restricted event: %v", test.Session,
+				!test.Accessible)
+		}
+	}
+}
+
+func TestRequiredRole(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {Roles: map[string][]string{"board": {"alice"}}}}
+	defer func() { moduleConfig.Sites = nil }()
+	role := service.TextField(" board ")
+	unknown := service.TextField("nobody")
+	start := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	public := testEvent("/events/public", start)
+	board := testEvent("/events/board", start)
+	board.Fields["events.RequiredRole"] = &role
+	secret := testEvent("/events/secret", start)
+	secret.Fields["events.RequiredRole"] = &unknown
+	reader := newTestReader(&service.Node{Path: "/events"}, public, board,
+		secret)
+	tests := []struct {
+		Session *service.UserSession
+		Paths   string
+	}{
+		{nil, "/events/public"},
+		{&service.UserSession{User: &service.User{Login: "bob"}},
+			"/events/public"},
+		{&service.UserSession{User: &service.User{Login: "alice"}},
+			"/events/public /events/board"},
+	}
+	for _, test := range tests {
+		req := &service.Request{Site: "example", Session: test.Session}
+		list, err := getEvents(req, reader, "/events", eventsQuery{Limit: -1})
+		if err != nil {
+			t.Fatalf("getEvents() failed: %v", err)
+		}
+		if got := eventPaths(list.Past); got != test.Paths {
+			t.Errorf("getEvents(%v) = %q, should be %q", test.Session, got,
+				test.Paths)
+		}
+		feed := string(renderICal("example", 0, list.Past))
+		if strings.Contains(feed, "/events/secret") ||
+			strings.Contains(feed, "/events/board") !=
+				strings.Contains(test.Paths, "/events/board") {
+			t.Errorf("feed for %v has wrong events:\n%v", test.Session, feed)
+		}
+		for _, event := range []*service.Node{public, board, secret} {
+			if accessible(req, event) != strings.Contains(test.Paths,
+				event.Path) {
+				t.Errorf("accessible(%v, %v) should be %v", test.Session,
+					event.Path, !accessible(req, event))
+			}
+		}
+	}
+}
+
+func TestIsFull(t *testing.T) {
+	yes, no := service.BoolField(true), service.BoolField(false)
+	text := func(value string) *service.TextField {
+		field := service.TextField(value)
+		return &field
+	}
+	tests := []struct {
+		Capacity, Registered string
+		SoldOut              *service.BoolField
+		Full                 bool
+	}{
+		{"", "", nil, false},
+		{"", "", &yes, true},
+		{"10", "3", nil, false},
+		{"10", "10", nil, true},
+		{"10", "12", nil, true},
+		{"10", "10", &no, true},
+		// The manual flag takes precedence over free spots.
+		{"10", "3", &yes, true},
+		{"", "3", &yes, true},
+	}
+	for i, test := range tests {
+		node := &service.Node{Fields: map[string]service.Field{
+			"events.Capacity":   text(test.Capacity),
+			"events.Registered": text(test.Registered),
+		}}
+		if test.SoldOut != nil {
+			node.Fields["events.SoldOut"] = test.SoldOut
+		}
+		if full := (eventCtx{Node: node}).IsFull(); full != test.Full {
+			t.Errorf("%d: IsFull() = %v, should be %v", i, full, test.Full)
+		}
+	}
+}
+
+func TestListTarget(t *testing.T) {
+	request := url.Values{"category": {"talk"}, "past": {"1"}}
+	root, query, err := listTarget("/events", request, nil)
+	if err != nil || root != "/events" || query.Encode() != request.Encode() {
+		t.Errorf("listTarget() without embed = %q, %v, %v", root, query, err)
+	}
+	request.Set("page", "2")
+	tests := []struct {
+		URI, Query string
+	}{
+		// Embedded lists inherit the filters of the embedding page.
+		{"/featured/?featured=1&limit=3",
+			"category=talk&featured=1&limit=3&page=2"},
+		{"/featured/?category=music", "category=music&page=2"},
+		// Isolated ones ignore them.
+		{"/featured/?featured=1&limit=3&isolated",
+			"featured=1&isolated=&limit=3"},
+	}
+	for _, test := range tests {
+		embed := &service.EmbedNode{URI: test.URI}
+		root, query, err = listTarget("/events", request, embed)
+		if err != nil {
+			t.Fatalf("listTarget(%q) failed: %v", test.URI, err)
+		}
+		if root != "/featured" || query.Encode() != test.Query {
+			t.Errorf("listTarget(%q) = %q, %q, should be %q", test.URI, root,
+				query.Encode(), test.Query)
+		}
+	}
+	if _, _, err := listTarget("/events", request,
+		&service.EmbedNode{URI: "%zz"}); err == nil {
+		t.Errorf("listTarget() of invalid embed URI should fail")
+	}
+}
+
+func TestBuildEventsDataExpiresAtMidnight(t *testing.T) {
+	now := time.Now()
+	midnight := endOfDay(now.In(siteLocation("example")))
+	// The event ends after midnight, but is no longer today then.
+	event := testEvent("/events/night", now.Add(-time.Hour))
+	event.Fields["events.EndTime"] = &service.DateTimeField{
+		midnight.Add(2 * time.Hour)}
+	reader := newTestReader(&service.Node{Path: "/events"}, event,
+		testEvent("/events/past", now.Add(-48*time.Hour)))
+	req := &service.Request{Site: "example"}
+	data, mods, err := buildEventsData(req, reader, "/events", url.Values{})
+	if err != nil {
+		t.Fatalf("buildEventsData() failed: %v", err)
+	}
+	if !data.Day.IsZero() || eventPaths(data.Ongoing) != "/events/night" {
+		t.Fatalf("buildEventsData() selected %q for day %v",
+			eventPaths(data.Ongoing), data.Day)
+	}
+	if !mods.Expire.Equal(midnight) {
+		t.Errorf("buildEventsData() expires at %v, should be %v", mods.Expire,
+			midnight)
+	}
+}
+
+func TestBuildEventsData(t *testing.T) {
+	now := time.Now()
+	reader := newTestReader(&service.Node{Path: "/events"},
+		testEvent("/events/past", now.Add(-48*time.Hour)),
+		testEvent("/events/ongoing", now.Add(-30*time.Minute)),
+		testEvent("/events/up", now.Add(48*time.Hour)))
+	req := &service.Request{Site: "example"}
+	data, mods, err := buildEventsData(req, reader, "/events", url.Values{})
+	if err != nil {
+		t.Fatalf("buildEventsData() failed: %v", err)
+	}
+	if eventPaths(data.Ongoing) != "/events/ongoing" ||
+		eventPaths(data.Upcoming) != "/events/up" ||
+		eventPaths(data.Past) != "/events/past" {
+		t.Errorf("buildEventsData() selected %q, %q, %q",
+			eventPaths(data.Ongoing), eventPaths(data.Upcoming),
+			eventPaths(data.Past))
+	}
+	if len(data.Tabs) != 3 || data.ListStart == nil || !data.ListStart.Equal(
+		now.Add(-48*time.Hour)) {
+		t.Errorf("buildEventsData() has tabs %v and start %v", data.Tabs,
+			data.ListStart)
+	}
+	expire := earliest(now.Add(30*time.Minute),
+		endOfDay(now.In(siteLocation("example"))))
+	if !mods.Expire.Equal(expire) {
+		t.Errorf("buildEventsData() expires at %v, should be %v", mods.Expire,
+			expire)
+	}
+	for _, query := range []string{"from=tomorrow", "to=2015-13-01",
+		"day=soon", "from=2015-03-02&to=2015-03-01"} {
+		values, _ := url.ParseQuery(query)
+		_, _, err := buildEventsData(req, reader, "/events", values)
+		if reqErr, ok := err.(*requestError); !ok ||
+			reqErr.Kind != errorBadRequest {
+			t.Errorf("buildEventsData(%q) should fail with a bad request, "+
+				"got %v", query, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultExcerptLength is the length of excerpts in characters if the
+// site does not configure one.
+const defaultExcerptLength = 160
+
+// ellipses contains the ellipsis appended to shortened texts by locale
+// if the site does not configure one. As texts are cut at word
+// boundaries, German puts a space before it.
+var ellipses = map[string]string{
+	"de": " …",
+	"en": "…",
+}
+
+// ellipsis returns the ellipsis of the given locale.
+func ellipsis(locale string) string {
+	if ellipsis, ok := ellipses[locale]; ok {
+		return ellipsis
+	}
+	return "…"
+}
+
+// excerptStyle describes how the excerpts of events are shortened.
+type excerptStyle struct {
+	// Length is the maximum length of excerpts in characters, including
+	// the ellipsis and the read more suffix.
+	Length int
+	// Ellipsis is appended to shortened excerpts.
+	Ellipsis string
+	// ReadMore is the text of the link to the event following the
+	// excerpt, separated by a space. There is none if empty.
+	ReadMore string
+}
+
+// getExcerptStyle returns the style of excerpts of the given site in the
+// given locale.
+func getExcerptStyle(site, locale string) excerptStyle {
+	settings := getSiteSettings(site)
+	ret := excerptStyle{
+		Length:   excerptLength(site),
+		Ellipsis: ellipsis(locale),
+		ReadMore: settings.ReadMore[locale],
+	}
+	if custom, ok := settings.Ellipses[locale]; ok {
+		ret.Ellipsis = custom
+	}
+	return ret
+}
+
+// excerptLength returns the length of excerpts of the given site.
+func excerptLength(site string) int {
+	if length := getSiteSettings(site).ExcerptLength; length > 0 {
+		return length
+	}
+	return defaultExcerptLength
+}
+
+// shorten shortens the given text to at most max characters including
+// the given ellipsis, cutting at a word boundary if possible.
+func shorten(text string, max int, ellipsis string) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	keep := max - utf8.RuneCountInString(ellipsis)
+	if keep < 0 {
+		keep = 0
+	}
+	cut := string(runes[:keep])
+	if space := strings.LastIndex(cut, " "); space > 0 {
+		cut = cut[:space]
+	}
+	return strings.TrimRight(cut, " ,.;:") + ellipsis
+}
+
+// Excerpt returns the body of the event as plain text shortened in the
+// given style. The excerpt leaves room for the read more suffix, so both
+// together are at most as long as the style's length.
+func (e eventCtx) Excerpt(style excerptStyle) string {
+	body := strings.Join(strings.Fields(stripHTML(getText(e.Node,
+		"core.Body"))), " ")
+	n := style.Length
+	if style.ReadMore != "" {
+		n -= utf8.RuneCountInString(style.ReadMore) + 1
+	}
+	if body == "" || n <= 0 {
+		return ""
+	}
+	return shorten(body, n, style.Ellipsis)
+}
@@ -0,0 +1,81 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestShorten(t *testing.T) {
+	tests := []struct {
+		Text     string
+		Max      int
+		Ellipsis string
+		Short    string
+	}{
+		{"Short text", 20, "…", "Short text"},
+		{"Exactly twenty chars", 20, "…", "Exactly twenty chars"},
+		{"Cut at a word boundary, please", 20, "…", "Cut at a word…"},
+		{"Cut at a word boundary, please", 20, " …", "Cut at a word …"},
+		{"Commas, are trimmed", 10, "…", "Commas…"},
+		{"Überlängenwörter", 8, "…", "Überlän…"},
+		{"Anything", 2, "...", "..."},
+	}
+	for _, test := range tests {
+		short := shorten(test.Text, test.Max, test.Ellipsis)
+		if short != test.Short {
+			t.Errorf("shorten(%q, %v, %q) = %q, should be %q", test.Text,
+				test.Max, test.Ellipsis, short, test.Short)
+		}
+	}
+}
+
+func TestExcerptStyle(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {ExcerptLength: 30,
+			Ellipses: map[string]string{"en": "..."},
+			ReadMore: map[string]string{"de": "weiterlesen", "en": "More"}}}
+	defer func() { moduleConfig.Sites = nil }()
+	body := service.HTMLField("<p>The quick brown fox jumps over the " +
+		"<em>lazy</em> dog.</p>")
+	event := eventCtx{Node: &service.Node{
+		Fields: map[string]service.Field{"core.Body": &body}}}
+	tests := []struct {
+		Site, Locale, Excerpt, ReadMore string
+	}{
+		{"example", "en", "The quick brown fox...", "More"},
+		{"example", "de", "The quick brown …", "weiterlesen"},
+		{"other", "en", "The quick brown fox jumps over the lazy dog.", ""},
+	}
+	for _, test := range tests {
+		style := getExcerptStyle(test.Site, test.Locale)
+		excerpt := event.Excerpt(style)
+		if excerpt != test.Excerpt || style.ReadMore != test.ReadMore {
+			t.Errorf("excerpt of %v in %v = %q, %q, should be %q, %q",
+				test.Site, test.Locale, excerpt, style.ReadMore, test.Excerpt,
+				test.ReadMore)
+		}
+		if style.ReadMore != "" && utf8.RuneCountInString(excerpt)+1+
+			utf8.RuneCountInString(style.ReadMore) > style.Length {
+			t.Errorf("excerpt of %v in %v is too long for its suffix",
+				test.Site, test.Locale)
+		}
+	}
+}
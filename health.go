@@ -0,0 +1,95 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+	mtemplate "pkg.monsti.org/monsti/api/util/template"
+)
+
+// nodeTypesRegistered is set once setup registered the node types.
+var nodeTypesRegistered bool
+
+// siteHealth describes whether the events root of a site is
+// resolvable.
+type siteHealth struct {
+	Site      string `json:"site"`
+	Root      string `json:"root"`
+	RootFound bool   `json:"rootFound"`
+	Error     string `json:"error,omitempty"`
+}
+
+// healthStatus describes whether the module is properly wired.
+type healthStatus struct {
+	Healthy   bool         `json:"healthy"`
+	NodeTypes bool         `json:"nodeTypesRegistered"`
+	Renderer  bool         `json:"rendererAvailable"`
+	Sites     []siteHealth `json:"sites"`
+}
+
+// checkHealth checks the module setup, the requested events list and,
+// for operators, the events lists configured for other sites, which are
+// fetched by getNode. Errors of the backend are not exposed.
+func checkHealth(req *service.Request,
+	getNode func(site, path string) (*service.Node, error),
+	renderer *mtemplate.Renderer, operator bool) healthStatus {
+	status := healthStatus{
+		NodeTypes: nodeTypesRegistered,
+		Renderer:  renderer != nil,
+	}
+	status.Healthy = status.NodeTypes && status.Renderer
+	roots := map[string]string{req.Site: req.NodePath}
+	sites := []string{req.Site}
+	for site, settings := range moduleConfig.Sites {
+		if operator && site != req.Site && settings.Root != "" {
+			roots[site] = settings.Root
+			sites = append(sites, site)
+		}
+	}
+	sort.Strings(sites[1:])
+	for _, site := range sites {
+		health := siteHealth{Site: site, Root: roots[site]}
+		node, err := getNode(site, roots[site])
+		if err != nil {
+			health.Error = "Could not fetch the events root"
+		}
+		health.RootFound = err == nil && node != nil
+		status.Healthy = status.Healthy && health.RootFound
+		status.Sites = append(status.Sites, health)
+	}
+	return status
+}
+
+// getHealthContext returns the module's health status as JSON. Only
+// operators, i.e. editors, get the status of other sites.
+func getHealthContext(req *service.Request, s *service.Session,
+	renderer *mtemplate.Renderer) (map[string][]byte, *service.CacheMods,
+	error) {
+	body, err := json.Marshal(checkHealth(req, s.Monsti().GetNode, renderer,
+		isEditor(req)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not encode health status: %v", err)
+	}
+	// The status differs between operators and visitors.
+	mods := &service.CacheMods{Expire: time.Now()}
+	return rawResponse(body, "application/json"), mods, nil
+}
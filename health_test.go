@@ -0,0 +1,73 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"pkg.monsti.org/monsti/api/service"
+	mtemplate "pkg.monsti.org/monsti/api/util/template"
+)
+
+func TestCheckHealth(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"healthy": {Root: "/events"},
+		"missing": {Root: "/removed"},
+		"broken":  {Root: "/events"},
+		"other":   {},
+	}
+	defer func() { moduleConfig.Sites = nil }()
+	registered := nodeTypesRegistered
+	nodeTypesRegistered = true
+	defer func() { nodeTypesRegistered = registered }()
+	getNode := func(site, path string) (*service.Node, error) {
+		switch {
+		case site == "broken":
+			return nil, errors.New("backend down")
+		case path == "/removed":
+			return nil, nil
+		}
+		return &service.Node{Path: path}, nil
+	}
+	renderer := &mtemplate.Renderer{}
+	req := &service.Request{Site: "healthy", NodePath: "/events"}
+	status := checkHealth(req, getNode, renderer, false)
+	expected := healthStatus{Healthy: true, NodeTypes: true, Renderer: true,
+		Sites: []siteHealth{{Site: "healthy", Root: "/events",
+			RootFound: true}}}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("checkHealth() = %+v, should be %+v", status, expected)
+	}
+	// Operators see the other sites with a root, sorted by name.
+	status = checkHealth(req, getNode, renderer, true)
+	expected.Healthy = false
+	expected.Sites = append(expected.Sites,
+		siteHealth{Site: "broken", Root: "/events",
+			Error: "Could not fetch the events root"},
+		siteHealth{Site: "missing", Root: "/removed"})
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("checkHealth() for operators = %+v, should be %+v", status,
+			expected)
+	}
+	req = &service.Request{Site: "missing", NodePath: "/removed"}
+	if status := checkHealth(req, getNode, nil, false); status.Healthy ||
+		status.Renderer || status.Sites[0].RootFound {
+		t.Errorf("checkHealth() without root and renderer = %+v", status)
+	}
+}
@@ -0,0 +1,237 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formats of UTC date times and of dates in iCalendar files.
+const (
+	icalTimeFormat = "20060102T150405Z"
+	icalDateFormat = "20060102"
+)
+
+// icalEscaper escapes text values according to RFC 5545.
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`,
+	"\r\n", `\n`, "\n", `\n`)
+
+// icalStatus maps event states to iCalendar STATUS values.
+var icalStatus = map[string]string{
+	statusScheduled: "CONFIRMED",
+	statusCancelled: "CANCELLED",
+	statusPostponed: "TENTATIVE",
+}
+
+// icalWriter writes the content lines of an iCalendar file.
+type icalWriter struct {
+	buf bytes.Buffer
+}
+
+// line writes a content line, folding it after 75 octets.
+func (w *icalWriter) line(name, value string) {
+	line := name + ":" + value
+	for first := true; len(line) > 0; first = false {
+		max := 75
+		if !first {
+			max = 74
+			w.buf.WriteString(" ")
+		}
+		cut := len(line)
+		if cut > max {
+			cut = max
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+		}
+		w.buf.WriteString(line[:cut])
+		w.buf.WriteString("\r\n")
+		line = line[cut:]
+	}
+}
+
+// text writes a content line with a text value.
+func (w *icalWriter) text(name, value string) {
+	w.line(name, icalEscaper.Replace(value))
+}
+
+// dateTime writes a content line with a UTC date time value.
+func (w *icalWriter) dateTime(name string, value time.Time) {
+	w.line(name, value.UTC().Format(icalTimeFormat))
+}
+
+// date writes a content line with a date value.
+func (w *icalWriter) date(name string, value time.Time) {
+	w.line(name+";VALUE=DATE", value.Format(icalDateFormat))
+}
+
+// eventUID returns a stable unique identifier of the given event of the
+// given site. Occurrences of recurring events are told apart by their
+// start.
+func eventUID(site string, event eventCtx) string {
+	id := strings.Trim(event.Path, "/")
+	if getText(event.Node, "events.Recurrence") != "" {
+		id += "-" + startTime(event.Node).UTC().Format(icalTimeFormat)
+	}
+	return fmt.Sprintf("%v@%v", id, site)
+}
+
+// maxReminder caps the lead time of reminders.
+const maxReminder = 7 * 24 * time.Hour
+
+// parseReminder parses the given lead time of reminders as ISO 8601
+// duration, e.g. PT30M, capped at maxReminder. It returns zero for an
+// empty value, which means no reminders.
+func parseReminder(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	reminder, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if reminder <= 0 {
+		return 0, fmt.Errorf("Reminder %q must be positive", value)
+	}
+	if reminder > maxReminder {
+		reminder = maxReminder
+	}
+	return reminder, nil
+}
+
+// icalDuration formats the given positive duration as negative iCalendar
+// duration, i.e. the given time before, e.g. -P1DT2H.
+func icalDuration(d time.Duration) string {
+	ret := "-P"
+	if days := d / (24 * time.Hour); days > 0 {
+		ret += fmt.Sprintf("%dD", days)
+		d -= days * 24 * time.Hour
+	}
+	if d > 0 {
+		ret += "T"
+		for _, unit := range []struct {
+			Length time.Duration
+			Suffix string
+		}{{time.Hour, "H"}, {time.Minute, "M"}, {time.Second, "S"}} {
+			if n := d / unit.Length; n > 0 {
+				ret += fmt.Sprintf("%d%s", n, unit.Suffix)
+				d -= n * unit.Length
+			}
+		}
+	}
+	return ret
+}
+
+// icalParam returns the given text as value of a quoted parameter.
+// Double quotes are not allowed in quoted parameters and are replaced by
+// apostrophes. Separators, which some clients take as end of the
+// parameter, and control characters are replaced by spaces.
+func icalParam(text string) string {
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '"':
+			return '\''
+		case r == ';' || r == ':' || r == ',' || unicode.IsControl(r):
+			return ' '
+		}
+		return r
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// alarm writes a VALARM displaying the given event the given time before
+// it starts. All day events start at a date without time of day, so
+// their reminders are given in whole days before it.
+func (w *icalWriter) alarm(event eventCtx, reminder time.Duration) {
+	if event.AllDay() {
+		day := 24 * time.Hour
+		reminder = (reminder + day - 1) / day * day
+	}
+	w.line("BEGIN", "VALARM")
+	w.line("ACTION", "DISPLAY")
+	w.text("DESCRIPTION", getText(event.Node, "core.Title"))
+	w.line("TRIGGER", icalDuration(reminder))
+	w.line("END", "VALARM")
+}
+
+// event writes the VEVENT of the given event with a reminder the given
+// time before its start, or without if zero.
+func (w *icalWriter) event(site string, event eventCtx, now time.Time,
+	reminder time.Duration) {
+	w.line("BEGIN", "VEVENT")
+	w.text("UID", eventUID(site, event))
+	stamp := now
+	if changed := event.LastModified(); changed != nil {
+		stamp = *changed
+	}
+	w.dateTime("DTSTAMP", stamp)
+	start := event.Start()
+	if event.AllDay() {
+		w.date("DTSTART", start)
+		w.date("DTEND", event.End())
+	} else {
+		w.dateTime("DTSTART", start)
+		if end := event.End(); end.After(start) {
+			w.dateTime("DTEND", end)
+		}
+	}
+	w.line("STATUS", icalStatus[event.Status()])
+	w.text("SUMMARY", getText(event.Node, "core.Title"))
+	if body := stripHTML(getText(event.Node, "core.Body")); body != "" {
+		w.text("DESCRIPTION", body)
+	}
+	if place := stripHTML(getText(event.Node, "events.Place")); place != "" {
+		w.text("LOCATION", place)
+	}
+	w.text("URL", eventLink(site, event))
+	// The organizer's address is the event's contact address or, without
+	// one, the site.
+	address := siteURL(site, "/")
+	if email := event.ContactEmail(); email != "" {
+		address = "mailto:" + email
+	}
+	w.line(`ORGANIZER;CN="`+icalParam(eventOrganizer(site, event))+`"`,
+		address)
+	if reminder > 0 {
+		w.alarm(event, reminder)
+	}
+	w.line("END", "VEVENT")
+}
+
+// renderICal serializes the given events to an iCalendar file. Each event
+// has a reminder the given time before its start unless it is zero.
+func renderICal(site string, reminder time.Duration,
+	events ...[]eventCtx) []byte {
+	w := &icalWriter{}
+	now := time.Now()
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//Monsti//Monsti Events//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	for _, list := range events {
+		for _, event := range list {
+			w.event(site, event, now, reminder)
+		}
+	}
+	w.line("END", "VCALENDAR")
+	return w.buf.Bytes()
+}
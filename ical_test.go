@@ -0,0 +1,161 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestRenderICalStatus(t *testing.T) {
+	start := &service.DateTimeField{time.Date(2015, 3, 1, 10, 0, 0, 0,
+		time.UTC)}
+	cancelled, postponed := service.TextField("cancelled"),
+		service.TextField("postponed")
+	tests := []struct {
+		Status service.Field
+		Line   string
+	}{
+		{nil, "STATUS:CONFIRMED\r\n"},
+		{&cancelled, "STATUS:CANCELLED\r\n"},
+		{&postponed, "STATUS:TENTATIVE\r\n"},
+	}
+	for _, test := range tests {
+		fields := map[string]service.Field{"events.StartTime": start}
+		if test.Status != nil {
+			fields["events.Status"] = test.Status
+		}
+		event := eventCtx{Node: &service.Node{Path: "/events/foo",
+			Fields: fields}, location: time.UTC}
+		out := string(renderICal("example", 0, []eventCtx{event}))
+		if !strings.Contains(out, test.Line) {
+			t.Errorf("feed of event with status %v lacks %q:\n%v",
+				test.Status, test.Line, out)
+		}
+	}
+}
+
+func TestRenderICalOrganizer(t *testing.T) {
+	start := &service.DateTimeField{time.Date(2015, 3, 1, 10, 0, 0, 0,
+		time.UTC)}
+	organizer := service.TextField("Foo, \"Bar\"; Baz:\r\nQux")
+	email := service.TextField("info@example.com")
+	tests := []struct {
+		Fields map[string]service.Field
+		Line   string
+	}{
+		{map[string]service.Field{"events.StartTime": start},
+			"ORGANIZER;CN=\"example\":http://example/\r\n"},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Organizer": &organizer, "events.ContactEmail": &email},
+			"ORGANIZER;CN=\"Foo 'Bar' Baz Qux\":mailto:info@example.com\r\n"},
+	}
+	for i, test := range tests {
+		event := eventCtx{Node: &service.Node{Path: "/events/foo",
+			Fields: test.Fields}, location: time.UTC}
+		out := string(renderICal("example", 0, []eventCtx{event}))
+		if !strings.Contains(out, test.Line) {
+			t.Errorf("%d: feed lacks %q:\n%v", i, test.Line, out)
+		}
+	}
+}
+
+func TestICalLineFolding(t *testing.T) {
+	w := &icalWriter{}
+	w.line("SUMMARY", strings.Repeat("ä", 50))
+	for i, line := range strings.Split(strings.TrimSuffix(w.buf.String(),
+		"\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is longer than 75 octets: %q", i, line)
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d is not indented: %q", i, line)
+		}
+	}
+	unfolded := strings.Replace(w.buf.String(), "\r\n ", "", -1)
+	if unfolded != "SUMMARY:"+strings.Repeat("ä", 50)+"\r\n" {
+		t.Errorf("unfolded line is %q", unfolded)
+	}
+}
+
+func TestParseReminder(t *testing.T) {
+	tests := []struct {
+		Value    string
+		Reminder time.Duration
+		Valid    bool
+	}{
+		{"", 0, true},
+		{"PT30M", 30 * time.Minute, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P30D", maxReminder, true},
+		{"PT0S", 0, false},
+		{"30", 0, false},
+	}
+	for _, test := range tests {
+		reminder, err := parseReminder(test.Value)
+		if (err == nil) != test.Valid || reminder != test.Reminder {
+			t.Errorf("parseReminder(%q) = %v, %v, should be %v, valid: %v",
+				test.Value, reminder, err, test.Reminder, test.Valid)
+		}
+	}
+}
+
+func TestRenderICalReminders(t *testing.T) {
+	yes := service.BoolField(true)
+	start := &service.DateTimeField{time.Date(2015, 3, 1, 10, 0, 0, 0,
+		time.UTC)}
+	timed := eventCtx{Node: &service.Node{Path: "/events/timed",
+		Fields: map[string]service.Field{"events.StartTime": start}},
+		location: time.UTC}
+	allDay := eventCtx{Node: &service.Node{Path: "/events/all-day",
+		Fields: map[string]service.Field{"events.StartTime": start,
+			"events.AllDay": &yes}}, location: time.UTC}
+	tests := []struct {
+		Reminder time.Duration
+		Triggers []string
+	}{
+		{0, nil},
+		{90 * time.Minute, []string{"-PT1H30M", "-P1D"}},
+		{26 * time.Hour, []string{"-P1DT2H", "-P2D"}},
+		{48 * time.Hour, []string{"-P2D", "-P2D"}},
+	}
+	for _, test := range tests {
+		out := string(renderICal("example", test.Reminder,
+			[]eventCtx{timed, allDay}))
+		events := strings.Split(out, "BEGIN:VEVENT\r\n")[1:]
+		if len(events) != 2 {
+			t.Fatalf("feed should contain two events:\n%v", out)
+		}
+		for i, event := range events {
+			alarms := strings.Count(event, "BEGIN:VALARM\r\n")
+			if test.Triggers == nil {
+				if alarms != 0 {
+					t.Errorf("event %d should have no alarm:\n%v", i, event)
+				}
+				continue
+			}
+			if alarms != 1 || !strings.Contains(event,
+				"TRIGGER:"+test.Triggers[i]+"\r\n") {
+				t.Errorf("event %d should have one alarm triggered %v before:"+
+					"\n%v", i, test.Triggers[i], event)
+			}
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// icalUnescaper reverts the escaping of iCalendar text values.
+var icalUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",",
+	`\n`, "\n", `\N`, "\n")
+
+// nonSlug matches characters not allowed in the names of imported
+// event nodes.
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// importedEvent is a VEVENT of an imported iCalendar file.
+type importedEvent struct {
+	UID, Summary, Description, Location string
+	// RecurrenceID is the raw value of the RECURRENCE-ID of events
+	// overriding a single occurrence of a recurring event.
+	RecurrenceID string
+	Start, End   time.Time
+	AllDay       bool
+}
+
+// icalLine is a content line of an iCalendar file.
+type icalLine struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// parseICalLine parses the given unfolded content line.
+func parseICalLine(line string) (icalLine, bool) {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			parts := strings.Split(line[:i], ";")
+			ret := icalLine{
+				Name:   strings.ToUpper(parts[0]),
+				Params: make(map[string]string),
+				Value:  line[i+1:],
+			}
+			for _, param := range parts[1:] {
+				if eq := strings.Index(param, "="); eq > 0 {
+					ret.Params[strings.ToUpper(param[:eq])] = strings.Trim(
+						param[eq+1:], `"`)
+				}
+			}
+			return ret, true
+		}
+	}
+	return icalLine{}, false
+}
+
+// parseICalTime parses the date or date time value of the given line.
+// Floating times and unknown time zones are interpreted in the given
+// time zone.
+func parseICalTime(line icalLine, location *time.Location) (time.Time,
+	bool, error) {
+	if line.Params["VALUE"] == "DATE" || len(line.Value) == 8 {
+		t, err := time.ParseInLocation(icalDateFormat, line.Value, location)
+		return t, true, err
+	}
+	if strings.HasSuffix(line.Value, "Z") {
+		t, err := time.Parse(icalTimeFormat, line.Value)
+		return t, false, err
+	}
+	if tzid := line.Params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			location = zone
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", line.Value, location)
+	return t, false, err
+}
+
+// parseICal returns the events of the given iCalendar file. Events
+// without start are skipped.
+func parseICal(data string, location *time.Location) ([]importedEvent,
+	error) {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n",
+		-1), "\n") {
+		if len(lines) > 0 && len(line) > 0 && (line[0] == ' ' ||
+			line[0] == '\t') {
+			lines[len(lines)-1] += line[1:]
+		} else if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	var events []importedEvent
+	var event *importedEvent
+	for _, raw := range lines {
+		line, ok := parseICalLine(raw)
+		if !ok {
+			continue
+		}
+		switch {
+		case line.Name == "BEGIN" && strings.ToUpper(line.Value) == "VEVENT":
+			event = &importedEvent{}
+		case line.Name == "END" && strings.ToUpper(line.Value) == "VEVENT":
+			if event != nil && !event.Start.IsZero() {
+				events = append(events, *event)
+			}
+			event = nil
+		case event == nil:
+		case line.Name == "UID":
+			event.UID = line.Value
+		case line.Name == "RECURRENCE-ID":
+			event.RecurrenceID = line.Value
+		case line.Name == "SUMMARY":
+			event.Summary = icalUnescaper.Replace(line.Value)
+		case line.Name == "DESCRIPTION":
+			event.Description = icalUnescaper.Replace(line.Value)
+		case line.Name == "LOCATION":
+			event.Location = icalUnescaper.Replace(line.Value)
+		case line.Name == "DTSTART", line.Name == "DTEND":
+			t, allDay, err := parseICalTime(line, location)
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse %v of %q: %v", line.Name,
+					event.UID, err)
+			}
+			if line.Name == "DTSTART" {
+				event.Start, event.AllDay = t, allDay
+			} else {
+				event.End = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// apply sets the fields of the given event node to the imported event
+// and checks if any of them changed.
+func (e importedEvent) apply(node *service.Node) bool {
+	changed := false
+	setText := func(id, value string, field service.Field) {
+		if getText(node, id) != value {
+			node.Fields[id] = field
+			changed = true
+		}
+	}
+	setTime := func(id string, value time.Time) {
+		if old, _ := getTime(node, id); !old.Equal(value) {
+			node.Fields[id] = &service.DateTimeField{Time: value}
+			changed = true
+		}
+	}
+	title := service.TextField(e.Summary)
+	setText("core.Title", e.Summary, &title)
+	// Descriptions are plain text.
+	body := strings.Replace(html.EscapeString(e.Description), "\n",
+		"<br>", -1)
+	bodyField := service.HTMLField(body)
+	setText("core.Body", body, &bodyField)
+	place := service.TextField(e.Location)
+	setText("events.Place", e.Location, &place)
+	uid := service.TextField(e.UID)
+	setText("events.UID", e.UID, &uid)
+	end := e.End
+	if e.AllDay && !end.IsZero() {
+		// The end of all day events is the day after their last day.
+		end = end.AddDate(0, 0, -1)
+		if !end.After(e.Start) {
+			end = time.Time{}
+		}
+	}
+	setTime("events.StartTime", e.Start)
+	setTime("events.EndTime", end)
+	if getBool(node, "events.AllDay") != e.AllDay {
+		allDay := service.BoolField(e.AllDay)
+		node.Fields["events.AllDay"] = &allDay
+		changed = true
+	}
+	return changed
+}
+
+// nodeStore reads and writes the nodes of sites and emits signals to
+// other modules. It is implemented by the client of the Monsti service.
+type nodeStore interface {
+	nodeReader
+	WriteNode(site, path string, node *service.Node) error
+	EmitSignal(name string, args interface{}, ret interface{}) error
+}
+
+// eventCreatedSignal is the signal emitted for each event created by the
+// module, so other modules may e.g. announce it. Its argument is an
+// eventCreated.
+const eventCreatedSignal = "events.EventCreated"
+
+// eventCreated describes an event created by the module. It contains
+// what announcements need, so subscribers don't have to fetch the node.
+type eventCreated struct {
+	Site  string    `json:"site"`
+	Path  string    `json:"path"`
+	URL   string    `json:"url"`
+	Title string    `json:"title"`
+	Start time.Time `json:"start"`
+	// End is the zero time if the event has no end.
+	End   time.Time `json:"end"`
+	Place string    `json:"place"`
+}
+
+// emitCreated emits the eventCreatedSignal for the given new event
+// node. Failures are logged only, as the event has been written.
+func emitCreated(req *service.Request, m nodeStore, node *service.Node) {
+	event := eventCtx{Node: node, location: siteLocation(req.Site)}
+	args := eventCreated{
+		Site:  req.Site,
+		Path:  node.Path,
+		URL:   eventLink(req.Site, event),
+		Title: getText(node, "core.Title"),
+		Start: event.Start(),
+		Place: getText(node, "events.Place"),
+	}
+	if end, ok := getTime(node, "events.EndTime"); ok {
+		args.End = end.In(event.zone())
+	}
+	if err := m.EmitSignal(eventCreatedSignal, args, nil); err != nil {
+		logger.Printf("Could not emit %v for %q of site %q: %v",
+			eventCreatedSignal, node.Path, req.Site, err)
+	}
+}
+
+// importResult is the outcome of an import.
+type importResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	// Rejected are the issues of the events not written as they are
+	// invalid, see checkEvent.
+	Rejected []eventIssue `json:"rejected,omitempty"`
+}
+
+// importEvents creates an event below the list at the given root path
+// for each event of the given iCalendar file. Events already imported
+// are matched by their UID and updated if they changed. Events without
+// UID are skipped as they could not be matched on re-import. So are
+// overrides of single occurrences, which would replace the recurring
+// event sharing their UID, and repeated UIDs. Invalid events are
+// rejected, see checkEvent. Each created event is announced to other
+// modules, see eventCreatedSignal.
+func importEvents(req *service.Request, m nodeStore, root,
+	data string) (*importResult, error) {
+	events, err := parseICal(data, siteLocation(req.Site))
+	if err != nil {
+		return nil, badRequest("Could not parse calendar: %v", err)
+	}
+	children, err := m.GetChildren(req.Site, root)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch children: %v", err)
+	}
+	existing := make(map[string]*service.Node)
+	taken := make(map[string]bool)
+	for _, child := range children {
+		taken[child.Path] = true
+		if uid := getText(child, "events.UID"); uid != "" {
+			existing[uid] = child
+		}
+	}
+	result := &importResult{}
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.UID == "" || event.RecurrenceID != "" || seen[event.UID] {
+			result.Skipped += 1
+			continue
+		}
+		seen[event.UID] = true
+		node, ok := existing[event.UID]
+		if ok {
+			node = copyNode(node)
+		} else {
+			node = &service.Node{
+				Path:   importPath(root, event, taken),
+				Type:   &service.NodeType{Id: "events.Event"},
+				Fields: make(map[string]service.Field),
+			}
+			taken[node.Path] = true
+		}
+		if !event.apply(node) {
+			result.Skipped += 1
+			continue
+		}
+		// Only events selecting a cover need their images to be checked.
+		var images []*service.Node
+		if ok && coverPath(node) != "" {
+			if images, err = getImages(m, req.Site, node.Path); err != nil {
+				return nil, fmt.Errorf("Could not fetch images of %q: %v",
+					node.Path, err)
+			}
+		}
+		if issues := checkEvent(node, images); len(issues) > 0 {
+			for _, issue := range issues {
+				result.Rejected = append(result.Rejected,
+					eventIssue{node.Path, issue})
+			}
+			continue
+		}
+		if err := m.WriteNode(req.Site, node.Path, node); err != nil {
+			return nil, fmt.Errorf("Could not write event %q: %v", node.Path,
+				err)
+		}
+		if ok {
+			result.Updated += 1
+		} else {
+			result.Created += 1
+			emitCreated(req, m, node)
+		}
+	}
+	return result, nil
+}
+
+// importPath returns an unused path below the given root for the given
+// imported event, derived from its summary.
+func importPath(root string, event importedEvent,
+	taken map[string]bool) string {
+	slug := strings.Trim(nonSlug.ReplaceAllString(
+		strings.ToLower(event.Summary), "-"), "-")
+	if slug == "" {
+		slug = "event"
+	}
+	ret := path.Join(root, slug)
+	for i := 2; taken[ret]; i++ {
+		ret = path.Join(root, fmt.Sprintf("%v-%d", slug, i))
+	}
+	return ret
+}
+
+// importKey is the secret key of import tokens. It is generated during
+// setup, so tokens become invalid when the module restarts.
+var importKey = make([]byte, 32)
+
+// generateImportKey generates a random importKey.
+func generateImportKey() error {
+	if _, err := rand.Read(importKey); err != nil {
+		return fmt.Errorf("Could not generate import key: %v", err)
+	}
+	return nil
+}
+
+// importToken returns the token the user of the given request has to
+// post along with calendars imported into the list at the given root
+// path. Other sites can't read it, which protects imports against cross
+// site requests.
+func importToken(req *service.Request, root string) string {
+	mac := hmac.New(sha256.New, importKey)
+	fmt.Fprintf(mac, "%v\x00%v\x00%v", req.Site, req.Session.User.Login, root)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getImportContext imports the iCalendar file posted in the calendar
+// form field into the list at the given root path and returns the
+// numbers of created, updated and skipped events as JSON. The token
+// form field must contain the import token, which editors get as JSON
+// by requesting the import without posting. Only editors may import.
+func getImportContext(req *service.Request, s *service.Session,
+	root string) (map[string][]byte, *service.CacheMods, error) {
+	if !isEditor(req) {
+		return nil, nil, forbidden("Only editors may import events")
+	}
+	// Neither tokens nor results may be served to others.
+	mods := &service.CacheMods{Expire: time.Now()}
+	token := importToken(req, root)
+	var out interface{}
+	if req.Method != "POST" {
+		out = struct {
+			Token string `json:"token"`
+		}{token}
+	} else {
+		if !hmac.Equal([]byte(req.FormData.Get("token")), []byte(token)) {
+			return nil, nil, forbidden("Invalid import token")
+		}
+		result, err := importEvents(req, s.Monsti(), root,
+			req.FormData.Get("calendar"))
+		if err != nil {
+			return nil, nil, err
+		}
+		out = result
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not encode import result: %v", err)
+	}
+	return rawResponse(body, "application/json"), mods, nil
+}
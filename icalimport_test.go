@@ -0,0 +1,282 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+BEGIN:VEVENT
+UID:talk@example.com
+SUMMARY:Talk\, with questions
+DESCRIPTION:First line\nsecond <line>
+LOCATION:Town Hall\; Room 1
+DTSTART;TZID=Europe/Berlin:20150301T190000
+DTEND:20150301T200000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:fair@example.com
+SUMMARY:A very long summary which is folded onto the next line of the
+  file
+DTSTART;VALUE=DATE:20150310
+DTEND;VALUE=DATE:20150312
+END:VEVENT
+BEGIN:VEVENT
+UID:nostart@example.com
+SUMMARY:No start
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Floating
+DTSTART:20150320T100000
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParseICal(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Could not load time zone: %v", err)
+	}
+	data := strings.Replace(testCalendar, "\n", "\r\n", -1)
+	events, err := parseICal(data, time.UTC)
+	if err != nil {
+		t.Fatalf("parseICal failed: %v", err)
+	}
+	expected := []importedEvent{
+		{UID: "talk@example.com", Summary: "Talk, with questions",
+			Description: "First line\nsecond <line>",
+			Location:    "Town Hall; Room 1",
+			Start:       time.Date(2015, 3, 1, 19, 0, 0, 0, berlin),
+			End:         time.Date(2015, 3, 1, 20, 0, 0, 0, time.UTC)},
+		{UID: "fair@example.com", Summary: "A very long summary which is " +
+			"folded onto the next line of the file",
+			Start:  time.Date(2015, 3, 10, 0, 0, 0, 0, time.UTC),
+			End:    time.Date(2015, 3, 12, 0, 0, 0, 0, time.UTC),
+			AllDay: true},
+		{Summary: "Floating",
+			Start: time.Date(2015, 3, 20, 10, 0, 0, 0, time.UTC)},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("parseICal returned %d events, should be %d: %+v",
+			len(events), len(expected), events)
+	}
+	for i, event := range events {
+		if event.UID != expected[i].UID || event.Summary != expected[i].Summary ||
+			event.Description != expected[i].Description ||
+			event.Location != expected[i].Location ||
+			!event.Start.Equal(expected[i].Start) ||
+			!event.End.Equal(expected[i].End) ||
+			event.AllDay != expected[i].AllDay {
+			t.Errorf("%d: parseICal returned %+v, should be %+v", i, event,
+				expected[i])
+		}
+	}
+	invalid := "BEGIN:VEVENT\nUID:x\nDTSTART:tomorrow\nEND:VEVENT\n"
+	if _, err := parseICal(invalid, time.UTC); err == nil {
+		t.Errorf("parseICal of invalid start should fail")
+	}
+}
+
+func TestImportedEventApply(t *testing.T) {
+	start := time.Date(2015, 3, 10, 0, 0, 0, 0, time.UTC)
+	event := importedEvent{UID: "fair", Summary: "Fair",
+		Description: "Come <in>\nnow", Start: start,
+		End: start.AddDate(0, 0, 2), AllDay: true}
+	node := &service.Node{Fields: make(map[string]service.Field)}
+	if !event.apply(node) {
+		t.Errorf("apply() to new node reports no change")
+	}
+	if body := getText(node, "core.Body"); body != "Come &lt;in&gt;<br>now" {
+		t.Errorf("body is %q", body)
+	}
+	// The exclusive end of all day events becomes their last day.
+	if end, _ := getTime(node, "events.EndTime"); !end.Equal(
+		start.AddDate(0, 0, 1)) {
+		t.Errorf("end is %v, should be %v", end, start.AddDate(0, 0, 1))
+	}
+	if event.apply(node) {
+		t.Errorf("apply() of same event reports a change")
+	}
+	event.Summary = "Book fair"
+	if !event.apply(node) || getText(node, "core.Title") != "Book fair" {
+		t.Errorf("apply() of changed summary did not update the title")
+	}
+}
+
+func TestImportEvents(t *testing.T) {
+	reader := newTestReader(&service.Node{Path: "/events"},
+		&service.Node{Path: "/events/talk-with-questions"})
+	req := &service.Request{Site: "example"}
+	result, err := importEvents(req, reader, "/events", testCalendar)
+	if err != nil {
+		t.Fatalf("importEvents() failed: %v", err)
+	}
+	// The event without UID can't be matched on re-import.
+	if !reflect.DeepEqual(*result, importResult{Created: 2, Skipped: 1}) {
+		t.Errorf("first import resulted in %+v", *result)
+	}
+	talk := reader.Nodes["/events/talk-with-questions-2"]
+	if talk == nil || getText(talk, "events.UID") != "talk@example.com" {
+		t.Fatalf("imported talk is %+v", talk)
+	}
+	if len(reader.Signals) != 2 {
+		t.Fatalf("first import emitted %+v", reader.Signals)
+	}
+	for _, signal := range reader.Signals {
+		created, ok := signal.Args.(eventCreated)
+		if signal.Name != eventCreatedSignal || !ok ||
+			created.Site != "example" || created.Title == "" ||
+			created.URL != "http://example"+created.Path+"/" ||
+			!created.Start.Equal(startTime(reader.Nodes[created.Path])) {
+			t.Errorf("first import emitted %+v", signal)
+		}
+	}
+	changed := strings.Replace(testCalendar, "Town Hall", "Atrium", 1)
+	result, err = importEvents(req, reader, "/events", changed)
+	if err != nil {
+		t.Fatalf("importEvents() failed: %v", err)
+	}
+	if !reflect.DeepEqual(*result, importResult{Updated: 1, Skipped: 2}) {
+		t.Errorf("re-import resulted in %+v", *result)
+	}
+	if len(reader.Signals) != 2 {
+		t.Errorf("re-import emitted %+v", reader.Signals[2:])
+	}
+	talk = reader.Nodes["/events/talk-with-questions-2"]
+	if place := getText(talk, "events.Place"); place != "Atrium; Room 1" {
+		t.Errorf("re-imported place is %q", place)
+	}
+	if _, err := importEvents(req, reader, "/events",
+		"BEGIN:VEVENT\nDTSTART:x\nEND:VEVENT"); err == nil {
+		t.Errorf("importEvents() of invalid calendar should fail")
+	}
+}
+
+func TestImportEventsRejected(t *testing.T) {
+	reader := newTestReader(&service.Node{Path: "/events"})
+	req := &service.Request{Site: "example"}
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:backwards@example.com",
+		"SUMMARY:Backwards",
+		"DTSTART:20150301T100000Z",
+		"DTEND:20150301T090000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:instant@example.com",
+		"SUMMARY:Instant",
+		"DTSTART:20150301T100000Z",
+		"DTEND:20150301T100000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	result, err := importEvents(req, reader, "/events", calendar)
+	if err != nil {
+		t.Fatalf("importEvents() failed: %v", err)
+	}
+	// Events may end when they start.
+	expected := importResult{Created: 1, Rejected: []eventIssue{
+		{"/events/backwards", issueEndBeforeStart}}}
+	if !reflect.DeepEqual(*result, expected) {
+		t.Errorf("import resulted in %+v, should be %+v", *result, expected)
+	}
+	if reader.Nodes["/events/backwards"] != nil ||
+		reader.Nodes["/events/instant"] == nil {
+		t.Errorf("import wrote %v", reader.Nodes)
+	}
+}
+
+func TestImportEventsInvalidCover(t *testing.T) {
+	cover := service.TextField("poster")
+	uid := service.TextField("talk@example.com")
+	talk := testEvent("/events/talk", time.Date(2015, 3, 1, 10, 0, 0, 0,
+		time.UTC))
+	talk.Fields["events.UID"] = &uid
+	talk.Fields["events.CoverImage"] = &cover
+	reader := newTestReader(&service.Node{Path: "/events"}, talk,
+		&service.Node{Path: "/events/talk/photo"})
+	req := &service.Request{Site: "example"}
+	calendar := strings.Join([]string{
+		"BEGIN:VEVENT",
+		"UID:talk@example.com",
+		"SUMMARY:Talk",
+		"DTSTART:20150301T100000Z",
+		"END:VEVENT",
+	}, "\r\n")
+	result, err := importEvents(req, reader, "/events", calendar)
+	if err != nil {
+		t.Fatalf("importEvents() failed: %v", err)
+	}
+	expected := importResult{Rejected: []eventIssue{
+		{"/events/talk", issueInvalidCover}}}
+	if !reflect.DeepEqual(*result, expected) {
+		t.Errorf("import resulted in %+v, should be %+v", *result, expected)
+	}
+	reader.Nodes["/events/talk/poster"] = &service.Node{
+		Path: "/events/talk/poster"}
+	result, err = importEvents(req, reader, "/events", calendar)
+	if err != nil || !reflect.DeepEqual(*result, importResult{Updated: 1}) {
+		t.Errorf("import with valid cover resulted in %+v, %v", result, err)
+	}
+}
+
+func TestImportEventsRepeatedUIDs(t *testing.T) {
+	reader := newTestReader(&service.Node{Path: "/events"})
+	req := &service.Request{Site: "example"}
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"RECURRENCE-ID:20150308T100000Z",
+		"SUMMARY:Moved meeting",
+		"DTSTART:20150308T120000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"SUMMARY:Meeting",
+		"DTSTART:20150301T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:weekly@example.com",
+		"SUMMARY:Duplicate",
+		"DTSTART:20150401T100000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	result, err := importEvents(req, reader, "/events", calendar)
+	if err != nil {
+		t.Fatalf("importEvents() failed: %v", err)
+	}
+	if !reflect.DeepEqual(*result, importResult{Created: 1, Skipped: 2}) {
+		t.Errorf("import resulted in %+v", *result)
+	}
+	meeting := reader.Nodes["/events/meeting"]
+	if meeting == nil || !startTime(meeting).Equal(time.Date(2015, 3, 1, 10,
+		0, 0, 0, time.UTC)) {
+		t.Errorf("imported meeting is %+v", meeting)
+	}
+	if len(reader.Nodes) != 2 {
+		t.Errorf("import wrote %d nodes", len(reader.Nodes)-1)
+	}
+}
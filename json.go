@@ -0,0 +1,99 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// jsonEvent is the JSON representation of an event.
+type jsonEvent struct {
+	Path      string   `json:"path"`
+	Title     string   `json:"title"`
+	StartTime string   `json:"startTime"`
+	Place     string   `json:"place"`
+	Body      string   `json:"body"`
+	Images    []string `json:"images"`
+}
+
+// jsonEvents is the JSON representation of an events list.
+type jsonEvents struct {
+	Ongoing  []jsonEvent `json:"ongoing"`
+	Upcoming []jsonEvent `json:"upcoming"`
+	Past     []jsonEvent `json:"past"`
+}
+
+// Formats of the bodies of events in JSON output.
+const (
+	contentHTML = "html"
+	contentText = "text"
+)
+
+// toJSONEvents converts the given events of the given site. The bodies
+// are given in the given content format, with tags stripped like in
+// feeds for contentText. Places are always plain text.
+func toJSONEvents(site string, events []eventCtx,
+	content string) []jsonEvent {
+	ret := make([]jsonEvent, len(events))
+	for i, event := range events {
+		ret[i] = jsonEvent{
+			Path:      event.Path,
+			Title:     getText(event.Node, "core.Title"),
+			StartTime: event.Start().Format(time.RFC3339),
+			Place:     stripHTML(getText(event.Node, "events.Place")),
+			Body:      getText(event.Node, "core.Body"),
+			Images:    make([]string, len(event.Images)),
+		}
+		if content == contentText {
+			ret[i].Body = stripHTML(ret[i].Body)
+		}
+		for j, image := range event.Images {
+			ret[i].Images[j] = siteURL(site, image.Path)
+		}
+	}
+	return ret
+}
+
+// renderJSON serializes the upcoming and past events of the given list
+// with bodies in the given content format, see toJSONEvents. As only
+// past events come with their images, the images of the ongoing and
+// upcoming events are fetched.
+func renderJSON(s *service.Session, site string, list *eventList,
+	content string) ([]byte, error) {
+	for _, events := range [][]eventCtx{list.Ongoing, list.Upcoming} {
+		for i := range events {
+			images, err := getImages(s.Monsti(), site, events[i].Path)
+			if err != nil {
+				return nil, err
+			}
+			events[i].Images = images
+		}
+	}
+	out, err := json.Marshal(jsonEvents{
+		Ongoing:  toJSONEvents(site, list.Ongoing, content),
+		Upcoming: toJSONEvents(site, list.Upcoming, content),
+		Past:     toJSONEvents(site, list.Past, content),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode events: %v", err)
+	}
+	return out, nil
+}
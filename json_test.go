@@ -0,0 +1,48 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestToJSONEventsContent(t *testing.T) {
+	body := service.HTMLField(
+		"<p>Bring <strong>food</strong> &amp; drinks.</p>")
+	event := eventCtx{Node: &service.Node{Path: "/events/foo",
+		Fields: map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{time.Date(2015, 3, 1,
+				10, 0, 0, 0, time.UTC)},
+			"core.Body": &body,
+		}}, location: time.UTC}
+	tests := []struct {
+		Content, Body string
+	}{
+		{contentHTML, "<p>Bring <strong>food</strong> &amp; drinks.</p>"},
+		{contentText, "Bring food & drinks."},
+	}
+	for _, test := range tests {
+		events := toJSONEvents("example", []eventCtx{event}, test.Content)
+		if len(events) != 1 || events[0].Body != test.Body {
+			t.Errorf("toJSONEvents(%q) = %v, should have body %q",
+				test.Content, events, test.Body)
+		}
+	}
+}
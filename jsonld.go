@@ -0,0 +1,124 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// schemaStatus maps event states to schema.org EventStatusType values.
+var schemaStatus = map[string]string{
+	statusScheduled: "http://schema.org/EventScheduled",
+	statusCancelled: "http://schema.org/EventCancelled",
+	statusPostponed: "http://schema.org/EventPostponed",
+}
+
+// schemaAttendance maps event types to schema.org
+// EventAttendanceModeEnumeration values.
+var schemaAttendance = map[string]string{
+	typeInPerson: "http://schema.org/OfflineEventAttendanceMode",
+	typeOnline:   "http://schema.org/OnlineEventAttendanceMode",
+	typeHybrid:   "http://schema.org/MixedEventAttendanceMode",
+}
+
+// eventJSONLD returns a script element containing the schema.org/Event
+// JSON-LD of the given event. Values are escaped by encoding/json, which
+// also escapes <, > and &, so they can't break out of the script
+// element.
+func eventJSONLD(site string, event eventCtx) ([]byte, error) {
+	data := map[string]interface{}{
+		"@context":    "http://schema.org",
+		"@type":       "Event",
+		"name":        getText(event.Node, "core.Title"),
+		"startDate":   event.Start().Format(time.RFC3339),
+		"url":         eventLink(site, event),
+		"eventStatus": schemaStatus[event.Status()],
+		"organizer": map[string]interface{}{
+			"@type": "Organization",
+			"name":  eventOrganizer(site, event),
+		},
+	}
+	if end := event.End(); end.After(event.Start()) {
+		data["endDate"] = end.Format(time.RFC3339)
+	}
+	location := map[string]interface{}{"@type": "Place"}
+	if place := stripHTML(getText(event.Node, "events.Place")); place != "" {
+		location["name"] = place
+	}
+	if event.HasLocation() {
+		location["geo"] = map[string]interface{}{
+			"@type":     "GeoCoordinates",
+			"latitude":  event.Latitude(),
+			"longitude": event.Longitude(),
+		}
+	}
+	data["eventAttendanceMode"] = schemaAttendance[event.EventType()]
+	var locations []interface{}
+	if len(location) > 1 && event.EventType() != typeOnline {
+		locations = append(locations, location)
+	}
+	if stream := event.StreamURL(); stream != "" {
+		locations = append(locations, map[string]interface{}{
+			"@type": "VirtualLocation",
+			"url":   stream,
+		})
+	}
+	switch len(locations) {
+	case 0:
+	case 1:
+		data["location"] = locations[0]
+	default:
+		data["location"] = locations
+	}
+	if body := stripHTML(getText(event.Node, "core.Body")); body != "" {
+		data["description"] = body
+	}
+	offer := map[string]interface{}{
+		"@type": "Offer",
+		"url":   eventLink(site, event),
+	}
+	if event.HasValidPrice() {
+		offer["price"] = strconv.FormatFloat(event.Price(), 'f', 2, 64)
+	}
+	if currency := event.Currency(); currency != "" {
+		offer["priceCurrency"] = currency
+	}
+	offer["availability"] = "http://schema.org/InStock"
+	if event.IsFull() {
+		offer["availability"] = "http://schema.org/SoldOut"
+	}
+	data["offers"] = offer
+	if age := event.MinAge(); age > 0 {
+		data["typicalAgeRange"] = strconv.Itoa(age) + "-"
+	}
+	if len(event.Images) > 0 {
+		images := make([]string, len(event.Images))
+		for i, image := range event.Images {
+			images[i] = siteURL(site, image.Path)
+		}
+		data["image"] = images
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode JSON-LD: %v", err)
+	}
+	return []byte(fmt.Sprintf(`<script type="application/ld+json">%s</script>`,
+		out)), nil
+}
@@ -0,0 +1,70 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestEventJSONLDAvailability(t *testing.T) {
+	yes := service.BoolField(true)
+	capacity, registered := service.TextField("10"), service.TextField("3")
+	full := service.TextField("10")
+	start := &service.DateTimeField{time.Now().Add(24 * time.Hour)}
+	tests := []struct {
+		Fields       map[string]service.Field
+		Availability string
+	}{
+		{map[string]service.Field{"events.StartTime": start},
+			"http://schema.org/InStock"},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Capacity": &capacity, "events.Registered": &registered},
+			"http://schema.org/InStock"},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Capacity": &capacity, "events.Registered": &full},
+			"http://schema.org/SoldOut"},
+		// Marking the event as sold out overrides the free spots.
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Capacity": &capacity, "events.Registered": &registered,
+			"events.SoldOut": &yes}, "http://schema.org/SoldOut"},
+	}
+	for i, test := range tests {
+		event := eventCtx{Node: &service.Node{Path: "/events/foo",
+			Fields: test.Fields}, location: time.UTC}
+		out, err := eventJSONLD("example", event)
+		if err != nil {
+			t.Fatalf("%d: eventJSONLD failed: %v", i, err)
+		}
+		out = bytes.TrimPrefix(out, []byte(`<script type="application/ld+json">`))
+		out = bytes.TrimSuffix(out, []byte(`</script>`))
+		var data struct {
+			Offers struct{ Availability string }
+		}
+		if err := json.Unmarshal(out, &data); err != nil {
+			t.Fatalf("%d: Could not decode JSON-LD: %v", i, err)
+		}
+		if data.Offers.Availability != test.Availability {
+			t.Errorf("%d: availability is %q, should be %q", i,
+				data.Offers.Availability, test.Availability)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+
+	"pkg.monsti.org/monsti/api/service"
+	"pkg.monsti.org/monsti/api/util/i18n"
+)
+
+// translatePhrases replaces the given English phrases by their
+// translations to the given locale. Phrases without translation are
+// kept.
+func translatePhrases(locale string, phrases ...*string) {
+	for _, phrase := range phrases {
+		translation := i18n.GenLanguageMap(*phrase, availableLocales)[locale]
+		if translation != "" {
+			*phrase = translation
+		}
+	}
+}
+
+// localizedFields are the fields of events which may have variants for
+// each available locale. The variant of a field for a locale has the id
+// of the field in the events namespace followed by an underscore and
+// the locale, e.g. events.Title_en for core.Title.
+var localizedFields = []string{"core.Title", "core.Body"}
+
+// localizedId returns the id of the variant of the given field for the
+// given locale.
+func localizedId(id, locale string) string {
+	return "events." + strings.TrimPrefix(id, "core.") + "_" + locale
+}
+
+// localize returns a copy of the given event whose localized fields
+// contain their variant for the given locale. Missing variants fall back
+// to the field itself and then to the variants of the other available
+// locales in order. Events without variants are returned as they are.
+func localize(event *service.Node, locale string) *service.Node {
+	var ret *service.Node
+	for _, id := range localizedFields {
+		candidates := []string{localizedId(id, locale), id}
+		for _, fallback := range availableLocales {
+			if fallback != locale {
+				candidates = append(candidates, localizedId(id, fallback))
+			}
+		}
+		for _, candidate := range candidates {
+			if strings.TrimSpace(stripHTML(getText(event, candidate))) == "" {
+				continue
+			}
+			if candidate != id {
+				if ret == nil {
+					ret = copyNode(event)
+				}
+				ret.Fields[id] = event.Fields[candidate]
+			}
+			break
+		}
+	}
+	if ret == nil {
+		return event
+	}
+	return ret
+}
+
+// localizeEvents localizes the given events for the given locale.
+func localizeEvents(events []*service.Node, locale string) []*service.Node {
+	ret := make([]*service.Node, len(events))
+	for i, event := range events {
+		ret[i] = localize(event, locale)
+	}
+	return ret
+}
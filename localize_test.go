@@ -0,0 +1,84 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestFeedLocale(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"feed":   {Locale: "de", FeedLocale: "en"},
+		"plain":  {Locale: "en"},
+		"broken": {Locale: "xx", FeedLocale: "yy"},
+	}
+	defer func() { moduleConfig.Sites = nil }()
+	tests := []struct {
+		Site, Lang, Locale string
+	}{
+		{"feed", "", "en"},
+		{"feed", "de", "de"},
+		{"feed", "xx", "en"},
+		{"plain", "", "en"},
+		{"plain", "de", "de"},
+		{"broken", "", availableLocales[0]},
+		{"other", "", availableLocales[0]},
+	}
+	for _, test := range tests {
+		if locale := feedLocale(test.Site, test.Lang); locale != test.Locale {
+			t.Errorf("feedLocale(%q, %q) = %q, should be %q", test.Site,
+				test.Lang, locale, test.Locale)
+		}
+	}
+}
+
+func TestLocalizedFeed(t *testing.T) {
+	title, titleEn := service.TextField("Sommerfest"),
+		service.TextField("Summer party")
+	body := service.HTMLField("<p>Mit Musik</p>")
+	event := &service.Node{Path: "/events/party",
+		Fields: map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{time.Date(2015, 7, 1,
+				18, 0, 0, 0, time.UTC)},
+			"core.Title":      &title,
+			"events.Title_en": &titleEn,
+			"core.Body":       &body,
+		}}
+	tests := []struct {
+		Locale, Summary, Description string
+	}{
+		{"en", "SUMMARY:Summer party", "DESCRIPTION:Mit Musik"},
+		{"de", "SUMMARY:Sommerfest", "DESCRIPTION:Mit Musik"},
+	}
+	for _, test := range tests {
+		localized := eventCtx{Node: localize(event, test.Locale),
+			location: time.UTC}
+		out := string(renderICal("example", 0, []eventCtx{localized}))
+		if !strings.Contains(out, test.Summary+"\r\n") ||
+			!strings.Contains(out, test.Description+"\r\n") {
+			t.Errorf("feed in %v lacks %q or %q:\n%v", test.Locale,
+				test.Summary, test.Description, out)
+		}
+	}
+	if getText(event, "core.Title") != "Sommerfest" {
+		t.Errorf("localize should not change the event")
+	}
+}
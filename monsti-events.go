@@ -23,157 +23,400 @@ package main
 
 import (
 	"fmt"
-	"net/url"
-
-	"sort"
+	"html"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path"
 	"strconv"
 	"time"
+
 	"pkg.monsti.org/monsti/api/service"
 	"pkg.monsti.org/monsti/api/util/i18n"
 	"pkg.monsti.org/monsti/api/util/module"
-	"pkg.monsti.org/monsti/api/util/nodes"
 	"pkg.monsti.org/monsti/api/util/settings"
 	mtemplate "pkg.monsti.org/monsti/api/util/template"
 )
 
+// availableLocales are the locales the node types are translated to. They
+// may be configured in the module's settings.
 var availableLocales = []string{"de", "en"}
 
-type eventCtx struct {
-	*service.Node
-	Image *service.Node
-}
-
-// Upcoming checks if this is an upcoming event.
-func (e eventCtx) Upcoming() bool {
-	return e.Fields["events.StartTime"].(*service.DateTimeField).
-		Time.After(time.Now())
-}
+// logger logs problems which don't fail requests. It is replaced by the
+// module's logger during setup.
+var logger = log.New(os.Stderr, "events ", log.LstdFlags)
 
-func getEvents(req *service.Request, s *service.Session, pastOnly,
-	upcomingOnly bool, limit int) (
-	[]eventCtx, []eventCtx, error) {
-	m := s.Monsti()
-	events, err := m.GetChildren(req.Site, "/aktionen")
+func getEventContext(reqId uint, embed *service.EmbedNode,
+	s *service.Session, m *settings.Monsti, renderer *mtemplate.Renderer) (
+	map[string][]byte, *service.CacheMods, error) {
+	req, err := s.Monsti().GetRequest(reqId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not get request: %v", err)
+	}
+	node, err := s.Monsti().GetNode(req.Site, req.NodePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Could not fetch children: %v", err)
+		return nil, nil, fmt.Errorf("Could not fetch event: %v", err)
 	}
-	order := func(left, right *service.Node) bool {
-		lleft := left.Fields["events.StartTime"].(*service.DateTimeField).Time
-		rright := right.Fields["events.StartTime"].(*service.DateTimeField).Time
-		return lleft.Before(rright)
+	if node == nil {
+		return nil, nil, notFound("No event at %q", req.NodePath)
 	}
-	sort.Sort(sort.Reverse(&nodes.Sorter{events, order}))
-
-	eventCtxs := make([]eventCtx, len(events))
-	pastIdx := 0
-	pastCount := 0
-	for idx := range events {
-		eventCtxs[idx].Node = events[idx]
-		if idx == pastIdx && eventCtxs[idx].Upcoming() {
-			pastIdx += 1
-		} else {
-			if upcomingOnly {
-				break
-			}
-			pastCount += 1
-			images, err := m.GetChildren(req.Site, events[idx].Path)
-			if err != nil {
-				return nil, nil, fmt.Errorf("Could not fetch children: %v", err)
-			}
-			if len(images) > 0 {
-				eventCtxs[idx].Image = images[0]
-			}
-		}
-		if limit != -1 && pastCount > limit {
-			break
+	node = localize(node, requestLocale(req))
+	if !accessible(req, node) {
+		// Members and role holders get the full page for the same URL.
+		mods := &service.CacheMods{
+			Deps:   []service.CacheDep{{Node: req.NodePath}},
+			Expire: time.Now(),
 		}
+		return map[string][]byte{
+			"EventRestricted": []byte("1"),
+			"EventTitle": []byte(html.EscapeString(
+				getText(node, "core.Title"))),
+		}, mods, nil
 	}
-	for i, j := 0, pastIdx-1; i < j; i, j = i+1, j-1 {
-		eventCtxs[i], eventCtxs[j] = eventCtxs[j], eventCtxs[i]
+	images, attachments, err := getMedia(s.Monsti(), req.Site, req.NodePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not fetch images: %v", err)
 	}
-	pastEnd := len(eventCtxs)
-	if limit != -1 && pastEnd > pastIdx+limit {
-		pastEnd = pastIdx + limit
+	renderedAttachments, err := renderer.Render("events/event-attachments",
+		mtemplate.Context{"Attachments": eventAttachments(attachments)},
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not render template: %v", err)
 	}
-	if upcomingOnly {
-		pastEnd = pastIdx
+	rendered, err := renderer.Render("events/event-images",
+		mtemplate.Context{"Images": eventImages(node, images)},
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not render template: %v", err)
 	}
-	upcomingEnd := pastIdx
-	if pastOnly {
-		upcomingEnd = 0
+	prev, next, personalNav, err := getSiblings(req, s, node)
+	if err != nil {
+		return nil, nil, err
 	}
-	return eventCtxs[:upcomingEnd], eventCtxs[pastIdx:pastEnd], nil
-}
-
-func getEventContext(reqId uint, embed *service.EmbedNode,
-	s *service.Session, m *settings.Monsti, renderer *mtemplate.Renderer) (
-	map[string][]byte, *service.CacheMods, error) {
-	req, err := s.Monsti().GetRequest(reqId)
+	nav, err := renderer.Render("events/event-nav",
+		mtemplate.Context{"PrevEvent": prev, "NextEvent": next},
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
 	if err != nil {
-		return nil, nil, fmt.Errorf("Could not get request: %v", err)
+		return nil, nil, fmt.Errorf("Could not render template: %v", err)
 	}
-	images, err := s.Monsti().GetChildren(req.Site, req.NodePath)
+	relatedEvents, personalRelated := getRelated(req, s, node)
+	related, err := renderer.Render("events/event-related",
+		mtemplate.Context{"RelatedEvents": relatedEvents},
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
 	if err != nil {
-		return nil, nil, fmt.Errorf("Could not fetch images: %v", err)
+		return nil, nil, fmt.Errorf("Could not render template: %v", err)
 	}
-	rendered, err := renderer.Render("events/event-images",
-		mtemplate.Context{"Images": images},
-		req.Session.Locale, m.GetSiteTemplatesPath(req.Site))
+	share, err := renderer.Render("events/event-share",
+		mtemplate.Context{"Share": shareLinks(req.Site, eventCtx{Node: node})},
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
 	if err != nil {
 		return nil, nil, fmt.Errorf("Could not render template: %v", err)
 	}
+	// The images and attachments are children of the event. The
+	// navigation changes if siblings are added, removed or moved, the
+	// related events if they change or broken references are fixed.
 	mods := &service.CacheMods{
-		Deps: []service.CacheDep{{Node: req.NodePath, Descend: 1}},
+		Deps: []service.CacheDep{
+			{Node: req.NodePath, Descend: 1},
+			{Node: path.Dir(req.NodePath), Descend: 1},
+		},
+	}
+	for _, ref := range relatedPaths(node) {
+		mods.Deps = append(mods.Deps, service.CacheDep{Node: ref})
+	}
+	// The classes of the related events change when they start soon,
+	// start or end and, for those taking place today, at midnight.
+	mods.Expire = earliest(nextTransition(time.Now(), relatedEvents),
+		nextSoonChange(time.Now(), soonWindow(req.Site), relatedEvents))
+	if anyToday(relatedEvents) {
+		mods.Expire = earliest(mods.Expire,
+			endOfDay(time.Now().In(siteLocation(req.Site))))
+	}
+	// Pages showing restricted events or linking to them are not shared
+	// between visitors.
+	if personalNav || personalRelated {
+		mods.Expire = time.Now()
+	}
+	expireIfSessionDependent(mods, []*service.Node{node})
+	ctx := map[string][]byte{
+		"EventImages": rendered,
+		"EventNav":    nav,
+		"EventPlace":  renderPlace(req.Site, getText(node, "events.Place")),
+	}
+	ctx["EventAttachments"] = renderedAttachments
+	ctx["EventRelated"] = related
+	ctx["EventShare"] = share
+	// The node given to the template by the host is not localized.
+	ctx["EventTitle"] = []byte(html.EscapeString(getText(node, "core.Title")))
+	ctx["EventBody"] = []byte(getText(node, "core.Body"))
+	location := siteLocation(req.Site)
+	event := eventCtx{Node: node, Images: images, location: location}
+	if date := req.Query.Get("occurrence"); date != "" {
+		// Links to occurrences of recurring events show the times of the
+		// occurrence. Unknown occurrences show the base event.
+		occurrence := findOccurrence(node, date, location)
+		if occurrence != nil {
+			event.Node = occurrence
+			ctx["EventOccurrence"] = []byte(date)
+		}
 	}
-	return map[string][]byte{"EventImages": rendered}, mods, nil
+	switch event.EventType() {
+	case typeOnline:
+		ctx["EventOnline"] = []byte("1")
+	case typeHybrid:
+		ctx["EventHybrid"] = []byte("1")
+	}
+	// URLs used in attributes are escaped by the template, escaping them
+	// here as well would break their query strings.
+	if stream := event.StreamURL(); stream != "" {
+		ctx["EventStreamURL"] = []byte(stream)
+	}
+	if external := event.ExternalURL(); external != "" {
+		ctx["EventExternalURL"] = []byte(external)
+	}
+	ctx["EventGoogleCalURL"] = []byte(googleCalendarURL(req.Site, event))
+	ctx["EventOutlookCalURL"] = []byte(outlookCalendarURL(req.Site, event))
+	if left := event.SpotsLeft(); left != nil {
+		ctx["EventSpotsLeft"] = []byte(strconv.Itoa(*left))
+		ctx["EventCapacity"] = []byte(strconv.Itoa(event.Capacity()))
+	}
+	if event.IsFull() {
+		ctx["EventFull"] = []byte("1")
+	}
+	if event.Upcoming() && !event.RegistrationOpen() {
+		ctx["EventRegistrationClosed"] = []byte("1")
+	}
+	if price := event.FormattedPrice(requestLocale(req)); price != "" {
+		ctx["EventPrice"] = []byte(html.EscapeString(price))
+	}
+	if age := event.MinAgeLabel(requestLocale(req)); age != "" {
+		ctx["EventMinAge"] = []byte(html.EscapeString(age))
+	}
+	if email := event.ContactEmail(); email != "" {
+		// Both are encoded as character references to hide the address
+		// from harvesters. Browsers decode them in the link target, too.
+		// The link is built here, as templates would escape the
+		// references in its target once more.
+		ctx["EventContactEmail"] = []byte(obfuscate(email))
+		ctx["EventContactLink"] = []byte(fmt.Sprintf(`<a href="%v">%v</a>`,
+			obfuscate("mailto:"+email), obfuscate(email)))
+	}
+	ctx["EventOrganizer"] = []byte(
+		html.EscapeString(eventOrganizer(req.Site, event)))
+	ctx["EventMeta"] = eventMeta(req.Site, event)
+	if ctx["EventJSONLD"], err = eventJSONLD(req.Site, event); err != nil {
+		return nil, nil, err
+	}
+	if event.HasLocation() {
+		ctx["EventLatitude"] = []byte(
+			strconv.FormatFloat(event.Latitude(), 'f', -1, 64))
+		ctx["EventLongitude"] = []byte(
+			strconv.FormatFloat(event.Longitude(), 'f', -1, 64))
+	}
+	if event.AllDay() {
+		ctx["EventAllDay"] = []byte("1")
+	}
+	ctx["EventTime"] = []byte(html.EscapeString(
+		event.FormattedStart(requestLocale(req))))
+	if start := event.ISOStart(); start != "" {
+		ctx["EventTime"] = []byte(fmt.Sprintf(`<time datetime="%v">%s</time>`,
+			start, ctx["EventTime"]))
+	}
+	if changed := event.LastModified(); changed != nil {
+		// The relative time comes with the date as title. The page
+		// expires once the relative time changes.
+		local := changed.In(location)
+		ctx["EventLastModified"] = []byte(fmt.Sprintf(
+			`<time datetime="%v" title="%v">%v</time>`,
+			local.Format(time.RFC3339),
+			html.EscapeString(formatDate(local, requestLocale(req), true)),
+			html.EscapeString(event.RelativeLastModified(requestLocale(req)))))
+		mods.Expire = earliest(mods.Expire, agoChange(*changed, time.Now()))
+	}
+	return ctx, mods, nil
 }
 
+// getEventsContext returns the context of an events list. The limit
+// query parameter sets the maximum number of upcoming and of past events:
+// positive values are honored, zero or negative ones mean unlimited and
+// missing or malformed ones fall back to the site's default, see
+// parseLimit. Errors of non-HTML responses are returned as JSON, see
+// errorResponse.
+//
+// The context depends on the view, format, content, past, upcoming,
+// ongoing, limit, offset, page, category, order, featured,
+// featured_first, q, within, from, to, day, month, group, lang and
+// reminder query parameters and, except for feeds, on the request's
+// locale. They are normalized before use, see normalizeQuery, so the
+// links of the list, including its canonical URL, are the same for all
+// requests showing it.
+// The cache modifications carry no key, so the host has to cache each
+// combination of them separately, e.g. by the full request URL. All of
+// them are invalidated together by the dependencies on the list. Lists
+// containing restricted events or events requiring a role also depend
+// on the session, so they expire immediately instead of being shared
+// between visitors.
 func getEventsContext(reqId uint, embed *service.EmbedNode,
 	s *service.Session, m *settings.Monsti, renderer *mtemplate.Renderer) (
-	map[string][]byte, *service.CacheMods, error) {
+	ctx map[string][]byte, mods *service.CacheMods, err error) {
 	req, err := s.Monsti().GetRequest(reqId)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Could not get request: %v", err)
 	}
-	query := req.Query
-	if embed != nil {
-		url, err := url.Parse(embed.URI)
-		if err != nil {
-			return nil, nil, fmt.Errorf("Could not parse embed URI")
+	if embed == nil && rawRequest(req.Query) {
+		defer func() {
+			if err != nil {
+				ctx, mods, err = errorResponse(err), nil, nil
+			}
+		}()
+	}
+	root, query, err := listTarget(req.NodePath, req.Query, embed)
+	if err != nil {
+		return nil, nil, err
+	}
+	query = normalizeQuery(req.Site, query)
+	if embed == nil {
+		switch query.Get("view") {
+		case "report":
+			return getReportContext(req, s, root)
+		case "health":
+			return getHealthContext(req, s, renderer)
+		case "overview":
+			return getOverviewContext(req, s.Monsti(), root)
+		case "import":
+			return getImportContext(req, s, root)
+		case "calendar":
+			return getCalendarContext(req, s, m, renderer, root, query)
 		}
-		query = url.Query()
-	}
-	pastOnly := len(query["past"]) > 0
-	upcomingOnly := len(query["upcoming"]) > 0
-	limit := -1
-	if limitParam, err := strconv.Atoi(query.Get("limit")); err == nil {
-		limit = limitParam
-		if limit < 1 {
-			limit = 1
+		if query.Get("format") == "sitemap" {
+			return getSitemapContext(req, s, root)
 		}
 	}
-	context := mtemplate.Context{}
-	context["UpcomingOnly"] = upcomingOnly
-	context["PastOnly"] = pastOnly
-	context["UpcomingEvents"], context["PastEvents"], err = getEvents(
-		req, s, pastOnly, upcomingOnly, limit)
-	context["Embedded"] = embed
+	data, mods, err := buildEventsData(req, s.Monsti(), root, query)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Could not retrieve events: %v", err)
+		return nil, nil, err
 	}
-	rendered, err := renderer.Render("events/event-list", context,
-		req.Session.Locale, m.GetSiteTemplatesPath(req.Site))
-	if err != nil {
-		return nil, nil, fmt.Errorf("Could not render template: %v", err)
+	if data.RootMissing && rawRequest(query) {
+		return nil, nil, notFound("No event list at %q", root)
 	}
-
-	var expire time.Time
-	if len(context["UpcomingEvents"].([]eventCtx)) > 0 {
-		expire = context["UpcomingEvents"].([]eventCtx)[0].Fields["events.StartTime"].(*service.DateTimeField).Time
+	switch query.Get("format") {
+	case "ics":
+		reminder, err := parseReminder(query.Get("reminder"))
+		if err != nil {
+			return nil, nil, badRequest("Invalid reminder parameter: %v", err)
+		}
+		out := renderICal(req.Site, reminder, data.Ongoing, data.Upcoming,
+			data.Past)
+		return rawResponse(out, "text/calendar; charset=utf-8"), mods, nil
+	case "csv":
+		out, err := renderCSV(req.Site, data.Ongoing, data.Upcoming,
+			data.Past)
+		if err != nil {
+			return nil, nil, err
+		}
+		return downloadResponse(out, "text/csv; charset=utf-8",
+			"events.csv"), mods, nil
+	case "json":
+		content := query.Get("content")
+		switch content {
+		case "":
+			content = contentHTML
+		case contentHTML, contentText:
+		default:
+			return nil, nil, badRequest("Invalid content parameter %q", content)
+		}
+		out, err := renderJSON(s, req.Site, data.eventList, content)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rawResponse(out, "application/json"), mods, nil
+	case "atom":
+		list, err := s.Monsti().GetNode(req.Site, root)
+		if err != nil || list == nil {
+			return nil, nil, fmt.Errorf("Could not fetch list node: %v", err)
+		}
+		feed, err := renderAtom(req.Site, list, data.Ongoing, data.Upcoming,
+			data.Past)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rawResponse(feed, "application/atom+xml; charset=utf-8"), mods,
+			nil
 	}
-	mods := &service.CacheMods{
-		Deps:   []service.CacheDep{{Node: req.NodePath, Descend: 2}},
-		Expire: expire,
+	context := mtemplate.Context{
+		"UpcomingOnly":   data.UpcomingOnly,
+		"PastOnly":       data.PastOnly,
+		"OngoingOnly":    data.OngoingOnly,
+		"UpcomingEvents": data.Upcoming,
+		"PastEvents":     data.Past,
+		"Tabs":           data.Tabs,
+		"ListStart":      data.ListStart,
+		"ListEnd":        data.ListEnd,
+		"ActiveCategory": data.Category,
+		"Limit":          data.Limit,
+		"HasPrevPage":    data.HasPrevPage,
+		"HasNextPage":    data.HasNextPage,
+		"PrevOffset":     data.PrevOffset,
+		"NextOffset":     data.NextOffset,
+		"PrevPageURL":    data.PrevPageURL,
+		"NextPageURL":    data.NextPageURL,
+		"Embedded":       embed,
+		"NoEventsRoot":   data.RootMissing,
+	}
+	// Lets the host page emit canonical and prev/next link tags.
+	context["CanonicalURL"] = data.CanonicalURL
+	feeds := make(map[string]htmltemplate.URL)
+	for format, feed := range feedURLs(req.Site, root, query) {
+		// The webcal scheme would be filtered by the templates if not
+		// marked as safe.
+		feeds[format] = htmltemplate.URL(feed)
+	}
+	context["FeedURLs"] = feeds
+	context["IcsURL"] = feeds["ics"]
+	context["WebcalURL"] = feeds["webcal"]
+	// NextEvent starts at or after the earliest transition, so the
+	// cache expires when it starts.
+	context["NextEvent"] = nextEvent(data.Upcoming)
+	context["OngoingEvents"] = data.Ongoing
+	context["OngoingCount"] = data.OngoingCount
+	context["UpcomingCount"] = data.UpcomingCount
+	context["PastCount"] = data.PastCount
+	context["Order"] = data.Order
+	context["FeaturedOnly"] = data.FeaturedOnly
+	context["SearchQuery"] = data.Search
+	if !data.From.IsZero() {
+		context["RangeFrom"] = data.From.In(siteLocation(req.Site))
+	}
+	if !data.To.IsZero() {
+		context["RangeTo"] = data.To.In(siteLocation(req.Site))
+	}
+	context["Locale"] = requestLocale(req)
+	context["ExcerptStyle"] = getExcerptStyle(req.Site, requestLocale(req))
+	// The relative start times of upcoming events are refreshed when
+	// they change, the starts soon badges when an event enters the
+	// window. Both only add expiry times to the ones of buildEventsData,
+	// as the earliest of them applies.
+	mods.Expire = earliest(mods.Expire,
+		nextRelativeChange(time.Now(), data.Upcoming),
+		nextSoonChange(time.Now(), soonWindow(req.Site), data.Upcoming))
+	context["StartsSoonWindow"] = soonWindow(req.Site)
+	if data.Within > 0 {
+		context["WithinDays"] = data.Within
+	}
+	context["PastEventsByMonth"] = groupByMonth(data.Past)
+	context["UpcomingEventsByMonth"] = groupByMonth(data.Upcoming)
+	switch data.View {
+	case "by-venue":
+		context["Venues"] = groupByVenue(data.Ongoing, data.Upcoming,
+			data.Past)
+	case "print":
+		context["PrintGroups"] = printGroups(data.eventList,
+			query.Get("group"))
+	}
+	rendered, err := renderer.Render(listTemplate(data.View), context,
+		requestLocale(req), m.GetSiteTemplatesPath(req.Site))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not render template: %v", err)
 	}
 	return map[string][]byte{"EventList": rendered}, mods, nil
 }
@@ -181,6 +424,28 @@ func getEventsContext(reqId uint, embed *service.EmbedNode,
 func setup(c *module.ModuleContext) error {
 	G := func(in string) string { return in }
 	m := c.Session.Monsti()
+	logger = c.Logger
+	if err := loadSettings(c.Settings); err != nil {
+		c.Logger.Printf("Could not load settings, using defaults: %v", err)
+	}
+
+	if err := generateImportKey(); err != nil {
+		return err
+	}
+	freeLabels = i18n.GenLanguageMap(G("Free"), availableLocales)
+	allAgesLabels = i18n.GenLanguageMap(G("All ages"), availableLocales)
+	dateFormats = i18n.GenLanguageMap(G("January 2, 2006"), availableLocales)
+	dateTimeFormats = i18n.GenLanguageMap(G("January 2, 2006, 3:04 PM"),
+		availableLocales)
+	for i, name := range []string{G("January"), G("February"), G("March"),
+		G("April"), G("May"), G("June"), G("July"), G("August"),
+		G("September"), G("October"), G("November"), G("December")} {
+		monthNames[time.Month(i+1)] = i18n.GenLanguageMap(name,
+			availableLocales)
+	}
+	genRelativePhrases()
+	genDurationPhrases()
+	genSpotsPhrases()
 
 	nodeType := service.NodeType{
 		Id:        "events.Event",
@@ -195,14 +460,184 @@ func setup(c *module.ModuleContext) error {
 				Name: i18n.GenLanguageMap(G("Place"), availableLocales),
 				Type: new(service.TextFieldType),
 			},
+			{
+				Id:   "events.Latitude",
+				Name: i18n.GenLanguageMap(G("Latitude"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Longitude",
+				Name: i18n.GenLanguageMap(G("Longitude"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Organizer",
+				Name: i18n.GenLanguageMap(G("Organizer"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.EventType",
+				Name: i18n.GenLanguageMap(G("Event type"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.StreamURL",
+				Name: i18n.GenLanguageMap(G("Stream URL"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.ExternalURL",
+				Name: i18n.GenLanguageMap(G("External URL"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.ContactEmail",
+				Name: i18n.GenLanguageMap(G("Contact email"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
 			{
 				Id:       "events.StartTime",
 				Required: true,
 				Name:     i18n.GenLanguageMap(G("Start"), availableLocales),
 				Type:     new(service.DateTimeFieldType),
 			},
+			{
+				Id:   "events.AllDay",
+				Name: i18n.GenLanguageMap(G("All day"), availableLocales),
+				Type: new(service.BoolFieldType),
+			},
+			{
+				Id:   "events.EndTime",
+				Name: i18n.GenLanguageMap(G("End"), availableLocales),
+				Type: new(service.DateTimeFieldType),
+			},
+			{
+				Id:   "events.Status",
+				Name: i18n.GenLanguageMap(G("Status"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Category",
+				Name: i18n.GenLanguageMap(G("Category"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Duration",
+				Name: i18n.GenLanguageMap(G("Duration"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Recurrence",
+				Name: i18n.GenLanguageMap(G("Recurrence"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id: "events.RelatedEvents",
+				Name: i18n.GenLanguageMap(G("Related events"),
+					availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.VisibleFrom",
+				Name: i18n.GenLanguageMap(G("Visible from"), availableLocales),
+				Type: new(service.DateTimeFieldType),
+			},
+			{
+				Id:   "events.VisibleUntil",
+				Name: i18n.GenLanguageMap(G("Visible until"), availableLocales),
+				Type: new(service.DateTimeFieldType),
+			},
+			{
+				Id:   "events.Featured",
+				Name: i18n.GenLanguageMap(G("Featured"), availableLocales),
+				Type: new(service.BoolFieldType),
+			},
+			{
+				Id:   "events.Pinned",
+				Name: i18n.GenLanguageMap(G("Pinned"), availableLocales),
+				Type: new(service.BoolFieldType),
+			},
+			{
+				Id:   "events.Restricted",
+				Name: i18n.GenLanguageMap(G("Members only"), availableLocales),
+				Type: new(service.BoolFieldType),
+			},
+			{
+				Id:   "events.Price",
+				Name: i18n.GenLanguageMap(G("Price"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Currency",
+				Name: i18n.GenLanguageMap(G("Currency"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id: "events.RegistrationDeadline",
+				Name: i18n.GenLanguageMap(G("Registration deadline"),
+					availableLocales),
+				Type: new(service.DateTimeFieldType),
+			},
+			{
+				Id:   "events.Capacity",
+				Name: i18n.GenLanguageMap(G("Capacity"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.Registered",
+				Name: i18n.GenLanguageMap(G("Registered"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.RequiredRole",
+				Name: i18n.GenLanguageMap(G("Required role"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.SoldOut",
+				Name: i18n.GenLanguageMap(G("Sold out"), availableLocales),
+				Type: new(service.BoolFieldType),
+			},
+			{
+				Id: "events.CoverImage",
+				Name: i18n.GenLanguageMap(G("Cover image"),
+					availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				Id:   "events.MinAge",
+				Name: i18n.GenLanguageMap(G("Minimum age"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
+			{
+				// The UID of imported events allows to update them on
+				// re-import.
+				Id:     "events.UID",
+				Name:   i18n.GenLanguageMap(G("Calendar UID"), availableLocales),
+				Hidden: true,
+				Type:   new(service.TextFieldType),
+			},
 		},
 	}
+	for _, locale := range availableLocales {
+		for _, field := range []struct {
+			id, name  string
+			fieldType service.FieldType
+		}{
+			{"core.Title", G("Title"), new(service.TextFieldType)},
+			{"core.Body", G("Body"), new(service.HTMLFieldType)},
+		} {
+			name := i18n.GenLanguageMap(field.name, availableLocales)
+			for nameLocale := range name {
+				name[nameLocale] += " (" + locale + ")"
+			}
+			nodeType.Fields = append(nodeType.Fields, &service.FieldConfig{
+				Id:   localizedId(field.id, locale),
+				Name: name,
+				Type: field.fieldType,
+			})
+		}
+	}
 	if err := m.RegisterNodeType(&nodeType); err != nil {
 		return fmt.Errorf("Could not register %q node type: %v", nodeType.Id, err)
 	}
@@ -213,12 +648,19 @@ func setup(c *module.ModuleContext) error {
 		Name:      i18n.GenLanguageMap(G("Event list"), availableLocales),
 		Fields: []*service.FieldConfig{
 			{Id: "core.Title"},
+			{
+				Id:   "events.Sources",
+				Name: i18n.GenLanguageMap(G("Sources"), availableLocales),
+				Type: new(service.TextFieldType),
+			},
 		},
 	}
 	if err := m.RegisterNodeType(&nodeType); err != nil {
 		return fmt.Errorf("Could not register %q node type: %v", nodeType.Id, err)
 	}
 
+	nodeTypesRegistered = true
+
 	handler := service.NewNodeContextHandler(c.Sessions,
 		func(req uint, session *service.Session, nodeType string,
 			embedNode *service.EmbedNode) (
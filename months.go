@@ -0,0 +1,53 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "time"
+
+// monthGroup contains the events starting in a single month.
+type monthGroup struct {
+	// Label is the English name of the month, which templates translate
+	// for the request's locale, e.g. {{G .Label}} {{.Year}}.
+	Label  string
+	Year   int
+	Month  time.Month
+	Events []eventCtx
+}
+
+// groupByMonth groups the given events by the month of their start in
+// the site's time zone. The groups are ordered by the first event of
+// each month, the events of a group keep their order.
+func groupByMonth(events []eventCtx) []monthGroup {
+	var groups []monthGroup
+	index := make(map[int]int)
+	for _, event := range events {
+		start := event.Start()
+		key := start.Year()*12 + int(start.Month())
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, monthGroup{
+				Label: start.Month().String(),
+				Year:  start.Year(),
+				Month: start.Month(),
+			})
+		}
+		groups[i].Events = append(groups[i].Events, event)
+	}
+	return groups
+}
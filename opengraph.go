@@ -0,0 +1,59 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// maxMetaDescription is the maximum length of OpenGraph descriptions in
+// characters.
+const maxMetaDescription = 200
+
+// truncate shortens the given text to at most max characters, cutting at
+// a word boundary if possible and appending an ellipsis if shortened.
+func truncate(text string, max int) string {
+	return shorten(text, max, "…")
+}
+
+// eventMeta returns the OpenGraph meta elements of the given event of
+// the given site.
+func eventMeta(site string, event eventCtx) []byte {
+	var buf bytes.Buffer
+	property := func(name, content string) {
+		fmt.Fprintf(&buf, "<meta property=\"%v\" content=\"%v\">\n", name,
+			html.EscapeString(content))
+	}
+	property("og:type", "event")
+	property("og:title", getText(event.Node, "core.Title"))
+	property("og:url", siteURL(site, event.Path+"/"))
+	body := strings.Join(strings.Fields(stripHTML(getText(event.Node,
+		"core.Body"))), " ")
+	if body != "" {
+		property("og:description", truncate(body, maxMetaDescription))
+	}
+	if cover := event.Cover(); cover != nil {
+		property("og:image", siteURL(site, cover.Path))
+		property("og:image:alt", cover.Alt)
+	}
+	property("event:start_time", event.Start().Format(time.RFC3339))
+	return buf.Bytes()
+}
@@ -0,0 +1,122 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+	"pkg.monsti.org/monsti/api/util/nodes"
+)
+
+// maxOverviewFeatured is the maximum number of featured events included
+// in the overview.
+const maxOverviewFeatured = 3
+
+// overviewEvent contains the minimal data of an event in the overview.
+type overviewEvent struct {
+	Path  string    `json:"path"`
+	Title string    `json:"title"`
+	Start time.Time `json:"start"`
+	Cover string    `json:"cover,omitempty"`
+}
+
+// eventsOverview summarizes the upcoming events for dashboards.
+type eventsOverview struct {
+	Upcoming int             `json:"upcoming"`
+	Next     *overviewEvent  `json:"next"`
+	Featured []overviewEvent `json:"featured"`
+}
+
+// getOverviewEvent returns the overview data of the given event. Only
+// the event's children are fetched to find its cover image.
+func getOverviewEvent(req *service.Request, m nodeReader,
+	event eventCtx) (*overviewEvent, error) {
+	images, err := getImages(m, req.Site, event.Path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &overviewEvent{
+		Path:  event.Path,
+		Title: getText(event.Node, "core.Title"),
+		Start: event.Start(),
+	}
+	if cover := coverImage(event.Node, images); cover != nil {
+		ret.Cover = cover.Path
+	}
+	return ret, nil
+}
+
+// getOverviewContext returns a JSON summary of the upcoming events of
+// the list at the given root path: their number, the next event and some
+// featured events.
+func getOverviewContext(req *service.Request, m nodeReader,
+	root string) (map[string][]byte, *service.CacheMods, error) {
+	events, sources, missing, err := getSourceEvents(req, m, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if missing {
+		return nil, nil, notFound("No event list at %q", root)
+	}
+	location := siteLocation(req.Site)
+	raw := events
+	events = expandRecurrences(visibleEvents(req, events), location)
+	sort.Sort(&nodes.Sorter{events, byStart})
+	overview := eventsOverview{Featured: []overviewEvent{}}
+	var upcoming []eventCtx
+	for _, node := range events {
+		event := eventCtx{Node: node, location: location}
+		if !event.Upcoming() {
+			continue
+		}
+		overview.Upcoming += 1
+		upcoming = append(upcoming, event)
+		next := overview.Next == nil
+		featured := event.Featured() &&
+			len(overview.Featured) < maxOverviewFeatured
+		if !next && !featured {
+			continue
+		}
+		summary, err := getOverviewEvent(req, m, event)
+		if err != nil {
+			return nil, nil, err
+		}
+		if next {
+			overview.Next = summary
+		}
+		if featured {
+			overview.Featured = append(overview.Featured, *summary)
+		}
+	}
+	body, err := json.Marshal(overview)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not encode overview: %v", err)
+	}
+	// The covers of the next and featured events are part of the
+	// overview.
+	mods := &service.CacheMods{
+		Deps: sourceDeps(root, sources, descendImages),
+		Expire: earliest(nextTransition(time.Now(), upcoming),
+			visibilityChange(raw, time.Now())),
+	}
+	expireIfSessionDependent(mods, raw)
+	return rawResponse(body, "application/json"), mods, nil
+}
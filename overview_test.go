@@ -0,0 +1,86 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestGetOverviewContext(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	yes := service.BoolField(true)
+	nodes := []*service.Node{{Path: "/events"},
+		testEvent("/events/past", now.Add(-24*time.Hour))}
+	for i := 1; i <= 5; i++ {
+		event := testEvent(fmt.Sprintf("/events/up%d", i),
+			now.Add(time.Duration(i)*24*time.Hour))
+		if i > 1 {
+			event.Fields["events.Featured"] = &yes
+		}
+		nodes = append(nodes, event)
+	}
+	nodes[1].Fields["events.Featured"] = &yes
+	nodes = append(nodes, &service.Node{Path: "/events/up1/image"})
+	reader := newTestReader(nodes...)
+	req := &service.Request{Site: "example"}
+	ctx, mods, err := getOverviewContext(req, reader, "/events")
+	if err != nil {
+		t.Fatalf("getOverviewContext() failed: %v", err)
+	}
+	var overview eventsOverview
+	if err := json.Unmarshal(ctx[rawBodyKey], &overview); err != nil {
+		t.Fatalf("Could not decode overview: %v", err)
+	}
+	if overview.Upcoming != 5 {
+		t.Errorf("overview has %d upcoming events, should be 5",
+			overview.Upcoming)
+	}
+	if next := overview.Next; next == nil || next.Path != "/events/up1" ||
+		next.Cover != "/events/up1/image" || !next.Start.Equal(
+		now.Add(24*time.Hour)) {
+		t.Errorf("next event of overview is %+v", next)
+	}
+	var featured []string
+	for _, event := range overview.Featured {
+		featured = append(featured, event.Path)
+	}
+	if !reflect.DeepEqual(featured, []string{"/events/up2", "/events/up3",
+		"/events/up4"}) {
+		t.Errorf("featured events of overview are %v", featured)
+	}
+	// Only the children of the summarized events are fetched.
+	fetched := []string{"/events", "/events/up1", "/events/up2",
+		"/events/up3", "/events/up4"}
+	if !reflect.DeepEqual(reader.Fetched, fetched) {
+		t.Errorf("getOverviewContext() fetched the children of %v, should be "+
+			"%v", reader.Fetched, fetched)
+	}
+	if !mods.Expire.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("overview expires at %v, should be %v", mods.Expire,
+			now.Add(24*time.Hour))
+	}
+	if _, _, err := getOverviewContext(req, newTestReader(),
+		"/events"); err == nil {
+		t.Errorf("getOverviewContext() of missing root should fail")
+	}
+}
@@ -0,0 +1,105 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// currencySymbols maps the supported ISO 4217 currency codes to their
+// symbols.
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+	"CHF": "CHF",
+}
+
+// freeLabels maps locales to the translations of "Free". It is
+// generated during setup.
+var freeLabels map[string]string
+
+// parsePrice parses the given price, which may use a decimal comma.
+func parsePrice(price string) (float64, error) {
+	return strconv.ParseFloat(
+		strings.Replace(strings.TrimSpace(price), ",", ".", 1), 64)
+}
+
+// Price returns the price of the event or zero if it is free or has an
+// invalid price.
+func (e eventCtx) Price() float64 {
+	price, err := parsePrice(getText(e.Node, "events.Price"))
+	if err != nil || price < 0 {
+		return 0
+	}
+	return price
+}
+
+// HasValidPrice checks if the event's price is empty or a non-negative
+// number.
+func (e eventCtx) HasValidPrice() bool {
+	price := strings.TrimSpace(getText(e.Node, "events.Price"))
+	if price == "" {
+		return true
+	}
+	value, err := parsePrice(price)
+	return err == nil && value >= 0
+}
+
+// Currency returns the upper case ISO 4217 code of the currency of the
+// event's price.
+func (e eventCtx) Currency() string {
+	return strings.ToUpper(strings.TrimSpace(getText(e.Node,
+		"events.Currency")))
+}
+
+// Free checks if the event has no or a zero price. Events with an
+// invalid price are not free.
+func (e eventCtx) Free() bool {
+	return e.HasValidPrice() && e.Price() == 0
+}
+
+// FormattedPrice returns the price of the event for the given locale,
+// e.g. "12,50 €" in German or "€12.50" in English, or the translation of
+// "Free" for free events. It is empty if the price is invalid, which
+// must not be advertised as free.
+func (e eventCtx) FormattedPrice(locale string) string {
+	if !e.HasValidPrice() {
+		return ""
+	}
+	if e.Free() {
+		if label, ok := freeLabels[locale]; ok && label != "" {
+			return label
+		}
+		return "Free"
+	}
+	amount := strconv.FormatFloat(e.Price(), 'f', 2, 64)
+	currency := e.Currency()
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if locale == "de" {
+		return strings.TrimSpace(
+			strings.Replace(amount, ".", ",", 1) + " " + symbol)
+	}
+	if len(symbol) > 1 && symbol == currency {
+		symbol += " "
+	}
+	return symbol + amount
+}
@@ -0,0 +1,56 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "sort"
+
+// listTemplate returns the template rendering events lists in the given
+// view.
+func listTemplate(view string) string {
+	switch view {
+	case "by-venue":
+		return "events/event-by-venue"
+	case "print":
+		return "events/event-print"
+	}
+	return "events/event-list"
+}
+
+// printGroups returns the events of the given list grouped for printing,
+// by their month if group is "month" or else in a single group without
+// label.
+func printGroups(list *eventList, group string) []monthGroup {
+	events := printEvents(list)
+	if group == "month" {
+		return groupByMonth(events)
+	}
+	return []monthGroup{{Events: events}}
+}
+
+// printEvents returns the events of the given list in chronological
+// order, as printed programs list them.
+func printEvents(list *eventList) []eventCtx {
+	var ret []eventCtx
+	for _, events := range [][]eventCtx{list.Past, list.Ongoing,
+		list.Upcoming} {
+		ret = append(ret, events...)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return byStart(ret[i].Node, ret[j].Node)
+	})
+	return ret
+}
@@ -0,0 +1,94 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestListTemplate(t *testing.T) {
+	for view, template := range map[string]string{
+		"":         "events/event-list",
+		"by-venue": "events/event-by-venue",
+		"print":    "events/event-print",
+		"unknown":  "events/event-list",
+	} {
+		if got := listTemplate(view); got != template {
+			t.Errorf("listTemplate(%q) = %q, should be %q", view, got, template)
+		}
+	}
+}
+
+func TestPrintGroups(t *testing.T) {
+	event := func(path string, year int, month time.Month,
+		day int) eventCtx {
+		return eventCtx{Node: &service.Node{Path: path,
+			Fields: map[string]service.Field{
+				"events.StartTime": &service.DateTimeField{time.Date(year, month,
+					day, 10, 0, 0, 0, time.UTC)}}}, location: time.UTC}
+	}
+	// Past events are most recent first.
+	list := &eventList{
+		Past:     []eventCtx{event("/b", 2015, 2, 20), event("/a", 2015, 1, 5)},
+		Ongoing:  []eventCtx{event("/c", 2015, 2, 28)},
+		Upcoming: []eventCtx{event("/d", 2015, 3, 2), event("/e", 2016, 3, 1)},
+	}
+	tests := []struct {
+		Group  string
+		Groups [][]string
+	}{
+		{"", [][]string{{"/a", "/b", "/c", "/d", "/e"}}},
+		{"month", [][]string{{"/a"}, {"/b", "/c"}, {"/d"}, {"/e"}}},
+	}
+	for _, test := range tests {
+		groups := printGroups(list, test.Group)
+		if len(groups) != len(test.Groups) {
+			t.Errorf("printGroups(%q) returned %d groups, should be %d",
+				test.Group, len(groups), len(test.Groups))
+			continue
+		}
+		for i, group := range groups {
+			var paths []string
+			for _, event := range group.Events {
+				paths = append(paths, event.Path)
+			}
+			if len(paths) != len(test.Groups[i]) {
+				t.Errorf("printGroups(%q): group %d is %v, should be %v",
+					test.Group, i, paths, test.Groups[i])
+				continue
+			}
+			for j := range paths {
+				if paths[j] != test.Groups[i][j] {
+					t.Errorf("printGroups(%q): group %d is %v, should be %v",
+						test.Group, i, paths, test.Groups[i])
+					break
+				}
+			}
+		}
+	}
+	groups := printGroups(list, "month")
+	if groups[0].Label != "January" || groups[0].Year != 2015 ||
+		groups[3].Label != "March" || groups[3].Year != 2016 {
+		t.Errorf("unexpected month groups %v", groups)
+	}
+	if groups := printGroups(list, ""); groups[0].Label != "" {
+		t.Errorf("ungrouped events should have no label")
+	}
+}
@@ -0,0 +1,223 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// recurrenceHorizon limits the expansion of recurring events to
+// occurrences starting within this duration from now, in the future as
+// well as in the past.
+const recurrenceHorizon = 365 * 24 * time.Hour
+
+// maxOccurrences limits the number of occurrences of a recurring event
+// returned.
+const maxOccurrences = 1000
+
+// recurrence is a simple RRULE-style recurrence rule, e.g.
+// FREQ=WEEKLY;COUNT=10.
+type recurrence struct {
+	// Freq is one of DAILY, WEEKLY or MONTHLY.
+	Freq     string
+	Interval int
+	// Count is the maximum number of occurrences or zero if unlimited.
+	Count int
+	// Until is the last possible start of an occurrence or zero if
+	// unlimited.
+	Until time.Time
+}
+
+// parseRecurrence parses the given recurrence rule. Supported parts are
+// FREQ, INTERVAL, COUNT and UNTIL.
+func parseRecurrence(rule string) (*recurrence, error) {
+	ret := &recurrence{Interval: 1}
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("Invalid recurrence rule part %q", part)
+		}
+		key, value := strings.ToUpper(keyValue[0]), keyValue[1]
+		var err error
+		switch key {
+		case "FREQ":
+			ret.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			ret.Interval, err = strconv.Atoi(value)
+			if err == nil && ret.Interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			ret.Count, err = strconv.Atoi(value)
+			if err == nil && ret.Count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			ret.Until, err = time.Parse(icalTimeFormat, value)
+			if err != nil {
+				ret.Until, err = time.Parse(icalDateFormat, value)
+				ret.Until = endOfDay(ret.Until)
+			}
+		default:
+			err = fmt.Errorf("unsupported")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid recurrence rule part %q: %v", part,
+				err)
+		}
+	}
+	switch ret.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY":
+	default:
+		return nil, fmt.Errorf("Unsupported recurrence frequency %q", ret.Freq)
+	}
+	return ret, nil
+}
+
+// occurrences returns the start times of the occurrences of an event
+// starting at start, from the given time up to the given horizon.
+// Earlier occurrences are skipped but count towards the rule's Count.
+// The first occurrence is always included.
+func (r *recurrence) occurrences(start, from, horizon time.Time) []time.Time {
+	var ret []time.Time
+	count := 0
+	for i := 0; len(ret) < maxOccurrences; i++ {
+		var next time.Time
+		switch r.Freq {
+		case "DAILY":
+			next = start.AddDate(0, 0, i*r.Interval)
+		case "WEEKLY":
+			next = start.AddDate(0, 0, 7*i*r.Interval)
+		case "MONTHLY":
+			next = start.AddDate(0, i*r.Interval, 0)
+			if next.Day() != start.Day() {
+				// Skip months without this day, e.g. February 30th.
+				continue
+			}
+		}
+		if i > 0 && (next.After(horizon) ||
+			(!r.Until.IsZero() && next.After(r.Until))) {
+			break
+		}
+		if i == 0 || !next.Before(from) {
+			ret = append(ret, next)
+		}
+		if count += 1; r.Count > 0 && count == r.Count {
+			break
+		}
+	}
+	return ret
+}
+
+// occurrenceField marks the nodes of occurrences of recurring events.
+// It is not part of the node type.
+const occurrenceField = "events.IsOccurrence"
+
+// occurrenceDateFormat is the format of the dates of occurrences in their
+// links.
+const occurrenceDateFormat = "2006-01-02"
+
+// occurrence returns a copy of the given event node starting at the
+// given time. The end time is shifted accordingly.
+func occurrence(event *service.Node, start time.Time) *service.Node {
+	ret := copyNode(event)
+	offset := start.Sub(startTime(event))
+	marker := service.BoolField(true)
+	ret.Fields[occurrenceField] = &marker
+	ret.Fields["events.StartTime"] = &service.DateTimeField{Time: start}
+	for _, id := range []string{"events.EndTime",
+		"events.RegistrationDeadline"} {
+		if t, ok := getTime(event, id); ok {
+			ret.Fields[id] = &service.DateTimeField{Time: t.Add(offset)}
+		}
+	}
+	return ret
+}
+
+// expandRecurrences replaces recurring events by their occurrences from
+// one year ago up to one year from now. Occurrences are computed in the
+// given time zone.
+// Events with an invalid rule are kept as they are.
+func expandRecurrences(events []*service.Node,
+	location *time.Location) []*service.Node {
+	now := time.Now()
+	from, horizon := now.Add(-recurrenceHorizon), now.Add(recurrenceHorizon)
+	ret := make([]*service.Node, 0, len(events))
+	for _, event := range events {
+		rule := getText(event, "events.Recurrence")
+		start, ok := getTime(event, "events.StartTime")
+		if rule == "" || !ok {
+			ret = append(ret, event)
+			continue
+		}
+		rrule, err := parseRecurrence(rule)
+		if err != nil {
+			ret = append(ret, event)
+			continue
+		}
+		start = start.In(location)
+		for _, occurrenceStart := range rrule.occurrences(start, from,
+			horizon) {
+			ret = append(ret, occurrence(event, occurrenceStart))
+		}
+	}
+	return ret
+}
+
+// IsOccurrence checks if the event is an occurrence of a recurring event
+// as returned by expandRecurrences or findOccurrence.
+func (e eventCtx) IsOccurrence() bool {
+	return getBool(e.Node, occurrenceField)
+}
+
+// OccurrenceDate returns the day the occurrence starts on in the site's
+// time zone, e.g. 2015-03-05. It is empty if the event is no occurrence.
+func (e eventCtx) OccurrenceDate() string {
+	if !e.IsOccurrence() {
+		return ""
+	}
+	return e.Start().Format(occurrenceDateFormat)
+}
+
+// findOccurrence returns the occurrence of the given recurring event
+// starting on the given day in the given time zone, or nil if there is
+// none or the date is invalid.
+func findOccurrence(event *service.Node, date string,
+	location *time.Location) *service.Node {
+	day, err := time.ParseInLocation(occurrenceDateFormat, date, location)
+	if err != nil {
+		return nil
+	}
+	start, ok := getTime(event, "events.StartTime")
+	rrule, err := parseRecurrence(getText(event, "events.Recurrence"))
+	if !ok || err != nil {
+		return nil
+	}
+	for _, occurrenceStart := range rrule.occurrences(start.In(location), day,
+		endOfDay(day)) {
+		if startOfDay(occurrenceStart).Equal(day) {
+			return occurrence(event, occurrenceStart)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		Rule       string
+		Recurrence *recurrence
+	}{
+		{"FREQ=WEEKLY", &recurrence{Freq: "WEEKLY", Interval: 1}},
+		{"RRULE:freq=daily;INTERVAL=2;COUNT=5",
+			&recurrence{Freq: "DAILY", Interval: 2, Count: 5}},
+		{"FREQ=MONTHLY;UNTIL=20150301T120000Z", &recurrence{Freq: "MONTHLY",
+			Interval: 1, Until: time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)}},
+		{"FREQ=MONTHLY;UNTIL=20150301", &recurrence{Freq: "MONTHLY",
+			Interval: 1, Until: time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC)}},
+		{"", nil},
+		{"FREQ=YEARLY", nil},
+		{"FREQ=WEEKLY;INTERVAL=0", nil},
+		{"FREQ=WEEKLY;COUNT=x", nil},
+		{"FREQ=WEEKLY;BYDAY=MO", nil},
+	}
+	for _, test := range tests {
+		ret, err := parseRecurrence(test.Rule)
+		switch {
+		case test.Recurrence == nil && err == nil:
+			t.Errorf("parseRecurrence(%q) should fail", test.Rule)
+		case test.Recurrence != nil && err != nil:
+			t.Errorf("parseRecurrence(%q) failed: %v", test.Rule, err)
+		case test.Recurrence != nil && (ret.Freq != test.Recurrence.Freq ||
+			ret.Interval != test.Recurrence.Interval ||
+			ret.Count != test.Recurrence.Count ||
+			!ret.Until.Equal(test.Recurrence.Until)):
+			t.Errorf("parseRecurrence(%q) = %v, should be %v", test.Rule, ret,
+				test.Recurrence)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	start := time.Date(2015, 1, 31, 10, 0, 0, 0, time.UTC)
+	horizon := start.AddDate(0, 6, 0)
+	tests := []struct {
+		Rule        string
+		From        time.Time
+		Occurrences []string
+	}{
+		{"FREQ=WEEKLY;COUNT=3", start,
+			[]string{"2015-01-31", "2015-02-07", "2015-02-14"}},
+		// Skipped occurrences count towards the count.
+		{"FREQ=WEEKLY;COUNT=3", start.AddDate(0, 0, 8),
+			[]string{"2015-01-31", "2015-02-14"}},
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20150204", start,
+			[]string{"2015-01-31", "2015-02-02", "2015-02-04"}},
+		// Months without the 31st are skipped.
+		{"FREQ=MONTHLY;COUNT=3", start,
+			[]string{"2015-01-31", "2015-03-31", "2015-05-31"}},
+		{"FREQ=MONTHLY", start, []string{"2015-01-31", "2015-03-31",
+			"2015-05-31", "2015-07-31"}},
+	}
+	for _, test := range tests {
+		rrule, err := parseRecurrence(test.Rule)
+		if err != nil {
+			t.Fatalf("parseRecurrence(%q) failed: %v", test.Rule, err)
+		}
+		var dates []string
+		for _, occurrence := range rrule.occurrences(start, test.From,
+			horizon.AddDate(0, 0, 1)) {
+			dates = append(dates, occurrence.Format(occurrenceDateFormat))
+		}
+		if len(dates) != len(test.Occurrences) {
+			t.Errorf("occurrences of %q = %v, should be %v", test.Rule, dates,
+				test.Occurrences)
+			continue
+		}
+		for i := range dates {
+			if dates[i] != test.Occurrences[i] {
+				t.Errorf("occurrences of %q = %v, should be %v", test.Rule,
+					dates, test.Occurrences)
+				break
+			}
+		}
+	}
+}
+
+func TestFindOccurrence(t *testing.T) {
+	rule := service.TextField("FREQ=WEEKLY;COUNT=4")
+	start := time.Date(2015, 3, 5, 18, 0, 0, 0, time.UTC)
+	event := &service.Node{Path: "/events/meeting",
+		Fields: map[string]service.Field{
+			"events.StartTime":  &service.DateTimeField{start},
+			"events.EndTime":    &service.DateTimeField{start.Add(time.Hour)},
+			"events.Recurrence": &rule,
+		}}
+	if base := (eventCtx{Node: event}); base.IsOccurrence() ||
+		base.OccurrenceDate() != "" || base.Link() != "/events/meeting/" {
+		t.Errorf("base event should be no occurrence, links to %q",
+			base.Link())
+	}
+	for _, date := range []string{"2015-03-04", "2015-04-02", "2015-03-12x",
+		"yesterday"} {
+		if found := findOccurrence(event, date, time.UTC); found != nil {
+			t.Errorf("findOccurrence(%q) should find nothing", date)
+		}
+	}
+	found := findOccurrence(event, "2015-03-19", time.UTC)
+	if found == nil {
+		t.Fatalf("findOccurrence should find the occurrence on 2015-03-19")
+	}
+	occurrence := eventCtx{Node: found, location: time.UTC}
+	if !occurrence.IsOccurrence() {
+		t.Errorf("found event should be an occurrence")
+	}
+	if date := occurrence.OccurrenceDate(); date != "2015-03-19" {
+		t.Errorf("OccurrenceDate() = %q, should be 2015-03-19", date)
+	}
+	if end := occurrence.End(); !end.Equal(start.AddDate(0, 0, 14).Add(
+		time.Hour)) {
+		t.Errorf("occurrence ends at %v", end)
+	}
+	if link := occurrence.Link(); link !=
+		"/events/meeting/?occurrence=2015-03-19" {
+		t.Errorf("Link() = %q", link)
+	}
+	if len(event.Fields) != 3 {
+		t.Errorf("findOccurrence should not change the base event")
+	}
+}
+
+func TestOccurrencesDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Could not load time zone: %v", err)
+	}
+	rrule, err := parseRecurrence("FREQ=WEEKLY;COUNT=3")
+	if err != nil {
+		t.Fatalf("parseRecurrence failed: %v", err)
+	}
+	// Both weeks span a transition, spring forward on March 29th and fall
+	// back on October 25th.
+	for _, start := range []time.Time{
+		time.Date(2015, 3, 23, 19, 0, 0, 0, berlin),
+		time.Date(2015, 10, 19, 19, 0, 0, 0, berlin),
+	} {
+		event := testEvent("/events/foo", start.UTC())
+		for _, occurrenceStart := range rrule.occurrences(start, start,
+			start.AddDate(0, 1, 0)) {
+			node := occurrence(event, occurrenceStart)
+			local := eventCtx{Node: node, location: berlin}
+			if got := local.Start().Format("15:04"); got != "19:00" {
+				t.Errorf("occurrence on %v starts at %v, should be 19:00",
+					local.OccurrenceDate(), got)
+			}
+			if got := local.End().Format("15:04"); got != "20:00" {
+				t.Errorf("occurrence on %v ends at %v, should be 20:00",
+					local.OccurrenceDate(), got)
+			}
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// relativeUnits contains the phrases describing a coarse relative time
+// in a single locale. The singular and plural phrases of days and hours
+// take the number of units.
+type relativeUnits struct {
+	Day, Days, Hour, Hours, LessThanHour string
+}
+
+// relativeTexts contains the phrases of upcoming and started events and
+// of past times like modifications in a single locale.
+type relativeTexts struct{ Future, Past, Ago relativeUnits }
+
+// relativePhrases contains the relative phrases in the available locales
+// and in English. They are generated during
+// setup, see genRelativePhrases.
+var relativePhrases map[string]relativeTexts
+
+// genRelativePhrases generates relativePhrases from the translations of
+// the English phrases.
+func genRelativePhrases() {
+	G := func(in string) string { return in }
+	english := relativeTexts{
+		Future: relativeUnits{G("in %d day"), G("in %d days"),
+			G("in %d hour"), G("in %d hours"), G("in less than an hour")},
+		Past: relativeUnits{G("started %d day ago"), G("started %d days ago"),
+			G("started %d hour ago"), G("started %d hours ago"),
+			G("started less than an hour ago")},
+		Ago: relativeUnits{G("%d day ago"), G("%d days ago"), G("%d hour ago"),
+			G("%d hours ago"), G("less than an hour ago")},
+	}
+	relativePhrases = map[string]relativeTexts{"en": english}
+	for _, locale := range availableLocales {
+		texts := english
+		for _, units := range []*relativeUnits{&texts.Future, &texts.Past,
+			&texts.Ago} {
+			translatePhrases(locale, &units.Day, &units.Days, &units.Hour,
+				&units.Hours, &units.LessThanHour)
+		}
+		relativePhrases[locale] = texts
+	}
+}
+
+// TimeUntilStart returns the time until the event starts, which is
+// negative if it has already started.
+func (e eventCtx) TimeUntilStart() time.Duration {
+	return startTime(e.Node).Sub(time.Now())
+}
+
+// localRelativePhrases returns the relative phrases of the given locale.
+// Unavailable locales fall back to English.
+func localRelativePhrases(locale string) relativeTexts {
+	phrases, ok := relativePhrases[locale]
+	if !ok {
+		phrases = relativePhrases["en"]
+	}
+	return phrases
+}
+
+// formatRelative describes the given non-negative duration by the given
+// phrases. It is truncated to whole days or, if less than a day, to
+// whole hours.
+func formatRelative(units relativeUnits, d time.Duration) string {
+	switch days, hours := int(d/day), int(d/time.Hour); {
+	case days == 1:
+		return fmt.Sprintf(units.Day, days)
+	case days > 1:
+		return fmt.Sprintf(units.Days, days)
+	case hours == 1:
+		return fmt.Sprintf(units.Hour, hours)
+	case hours > 1:
+		return fmt.Sprintf(units.Hours, hours)
+	}
+	return units.LessThanHour
+}
+
+// RelativeStart describes the start of the event relative to now in the
+// given locale, e.g. "in 3 days" or "started 2 hours ago", see
+// formatRelative. Unavailable locales fall back to English.
+func (e eventCtx) RelativeStart(locale string) string {
+	phrases := localRelativePhrases(locale)
+	until := e.TimeUntilStart()
+	if until < 0 {
+		return formatRelative(phrases.Past, -until)
+	}
+	return formatRelative(phrases.Future, until)
+}
+
+// RelativeLastModified describes the last modification of the event
+// relative to now in the given locale, e.g. "2 days ago", see
+// formatRelative. It is empty if the modification time is unknown.
+func (e eventCtx) RelativeLastModified(locale string) string {
+	changed := e.LastModified()
+	if changed == nil {
+		return ""
+	}
+	since := time.Now().Sub(*changed)
+	if since < 0 {
+		since = 0
+	}
+	return formatRelative(localRelativePhrases(locale).Ago, since)
+}
+
+// relativeChange returns the time at which the RelativeStart of the
+// given event changes next.
+func relativeChange(event eventCtx, now time.Time) time.Time {
+	start := startTime(event.Node)
+	if until := start.Sub(now); until > 0 {
+		if until < time.Hour {
+			return start
+		}
+		unit := time.Hour
+		if until >= day {
+			unit = day
+		}
+		// The text changes once the remainder of the unit has passed.
+		return now.Add(until%unit + time.Nanosecond)
+	}
+	return agoChange(start, now)
+}
+
+// agoChange returns the time after the given past time at which its
+// description relative to now changes next.
+func agoChange(t, now time.Time) time.Time {
+	since := now.Sub(t)
+	if since < 0 {
+		return t.Add(time.Hour)
+	}
+	unit := time.Hour
+	if since >= day {
+		unit = day
+	}
+	return t.Add((since/unit + 1) * unit)
+}
+
+// nextRelativeChange returns the earliest time at which the
+// RelativeStart of any of the given events changes, or the zero time if
+// there are no events.
+func nextRelativeChange(now time.Time, events ...[]eventCtx) time.Time {
+	var next time.Time
+	for _, list := range events {
+		for _, event := range list {
+			next = earliest(next, relativeChange(event, now))
+		}
+	}
+	return next
+}
+
+// defaultSoonWindow is the time before their start during which events
+// start soon if the site does not configure it.
+const defaultSoonWindow = 24 * time.Hour
+
+// soonWindow returns the time before their start during which events of
+// the given site start soon.
+func soonWindow(site string) time.Duration {
+	if hours := getSiteSettings(site).StartsSoonHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultSoonWindow
+}
+
+// StartsSoon checks if the event starts within the given window from
+// now.
+func (e eventCtx) StartsSoon(window time.Duration) bool {
+	until := e.TimeUntilStart()
+	return until > 0 && until <= window
+}
+
+// nextSoonChange returns the earliest time at which any of the given
+// events enters the given window before its start, or the zero time if
+// there is none. Events leave the window when they start, which the
+// callers already cover by the start and end times of the events.
+func nextSoonChange(now time.Time, window time.Duration,
+	events ...[]eventCtx) time.Time {
+	var next time.Time
+	for _, list := range events {
+		for _, event := range list {
+			if enter := event.Start().Add(-window); enter.After(now) {
+				next = earliest(next, enter)
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,130 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestRelativeStart(t *testing.T) {
+	genRelativePhrases()
+	tests := []struct {
+		Offset   time.Duration
+		Relative string
+	}{
+		{30 * time.Minute, "in less than an hour"},
+		{90 * time.Minute, "in 1 hour"},
+		{5*time.Hour + time.Minute, "in 5 hours"},
+		{25 * time.Hour, "in 1 day"},
+		{73 * time.Hour, "in 3 days"},
+		{-30 * time.Minute, "started less than an hour ago"},
+		{-2*time.Hour - time.Minute, "started 2 hours ago"},
+		{-49 * time.Hour, "started 2 days ago"},
+	}
+	for _, test := range tests {
+		event := eventCtx{Node: &service.Node{Fields: map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{
+				time.Now().Add(test.Offset)}}}}
+		// Unavailable locales fall back to English.
+		for _, locale := range []string{"en", "xx"} {
+			if relative := event.RelativeStart(locale); relative !=
+				test.Relative {
+				t.Errorf("RelativeStart(%q) of event starting in %v = %q, "+
+					"should be %q", locale, test.Offset, relative, test.Relative)
+			}
+		}
+	}
+}
+
+func TestRelativeChange(t *testing.T) {
+	now := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Start, Change time.Time
+	}{
+		{now.Add(30 * time.Minute), now.Add(30 * time.Minute)},
+		{now.Add(90 * time.Minute), now.Add(30*time.Minute + 1)},
+		{now.Add(50 * time.Hour), now.Add(2*time.Hour + 1)},
+		{now.Add(-30 * time.Minute), now.Add(30 * time.Minute)},
+		{now.Add(-25 * time.Hour), now.Add(23 * time.Hour)},
+	}
+	for _, test := range tests {
+		event := eventCtx{Node: &service.Node{Fields: map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{test.Start}}}}
+		if change := relativeChange(event, now); !change.Equal(test.Change) {
+			t.Errorf("relativeChange of event starting at %v = %v, should be %v",
+				test.Start, change, test.Change)
+		}
+	}
+}
+
+func TestRelativeLastModified(t *testing.T) {
+	genRelativePhrases()
+	tests := []struct {
+		Age      time.Duration
+		Relative string
+	}{
+		{0, ""},
+		{10 * time.Minute, "less than an hour ago"},
+		{61 * time.Minute, "1 hour ago"},
+		{5*time.Hour + time.Minute, "5 hours ago"},
+		{25 * time.Hour, "1 day ago"},
+		{49 * time.Hour, "2 days ago"},
+		// Modifications in the future due to skewed clocks.
+		{-time.Hour, "less than an hour ago"},
+	}
+	for _, test := range tests {
+		node := &service.Node{}
+		if test.Age != 0 {
+			node.Changed = time.Now().Add(-test.Age)
+		}
+		event := eventCtx{Node: node}
+		if test.Age != 0 && event.LastModified() == nil {
+			t.Errorf("LastModified() of node changed %v ago is nil", test.Age)
+		}
+		if relative := event.RelativeLastModified("en"); relative !=
+			test.Relative {
+			t.Errorf("RelativeLastModified() of node changed %v ago = %q, "+
+				"should be %q", test.Age, relative, test.Relative)
+		}
+	}
+	if changed := (eventCtx{Node: &service.Node{}}).LastModified(); changed !=
+		nil {
+		t.Errorf("LastModified() of node without time = %v, should be nil",
+			changed)
+	}
+}
+
+func TestAgoChange(t *testing.T) {
+	now := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Time, Change time.Time
+	}{
+		{now.Add(-10 * time.Minute), now.Add(50 * time.Minute)},
+		{now.Add(-90 * time.Minute), now.Add(30 * time.Minute)},
+		{now.Add(-25 * time.Hour), now.Add(23 * time.Hour)},
+		{now.Add(time.Minute), now.Add(61 * time.Minute)},
+	}
+	for _, test := range tests {
+		if change := agoChange(test.Time, now); !change.Equal(test.Change) {
+			t.Errorf("agoChange(%v) = %v, should be %v", test.Time, change,
+				test.Change)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// Context keys used to hand non-HTML responses (reports, feeds) over to
+// the host, which serves the body verbatim with the given content type.
+const (
+	rawBodyKey        = "RawBody"
+	rawContentTypeKey = "RawContentType"
+	// rawDispositionKey holds the Content-Disposition of downloads.
+	rawDispositionKey = "RawContentDisposition"
+	// rawStatusKey holds the HTTP status code of error responses.
+	rawStatusKey = "RawStatus"
+)
+
+// rawResponse builds a context containing the given non-HTML body.
+func rawResponse(body []byte, contentType string) map[string][]byte {
+	return map[string][]byte{
+		rawBodyKey:        body,
+		rawContentTypeKey: []byte(contentType),
+	}
+}
+
+// downloadResponse builds a context containing the given non-HTML body
+// to be saved by the browser under the given file name.
+func downloadResponse(body []byte, contentType,
+	filename string) map[string][]byte {
+	ret := rawResponse(body, contentType)
+	ret[rawDispositionKey] = []byte(fmt.Sprintf("attachment; filename=%q",
+		filename))
+	return ret
+}
+
+// Issues which may be reported for an event.
+const (
+	issueMissingStartTime  = "missing-start-time"
+	issueMissingCover      = "missing-cover-image"
+	issueInvalidCover      = "invalid-cover-image"
+	issueEmptyBody         = "empty-body"
+	issuePastFeatured      = "past-featured"
+	issueInvalidDuration   = "invalid-duration"
+	issueEndBeforeStart    = "end-before-start"
+	issueEndAndDuration    = "end-time-and-duration"
+	issueLateDeadline      = "deadline-after-start"
+	issueInvalidRecurrence = "invalid-recurrence"
+	issueInvalidStatus     = "invalid-status"
+	issueIncompleteGeo     = "incomplete-coordinates"
+	issueInvalidGeo        = "invalid-coordinates"
+	issueInvalidURL        = "invalid-external-url"
+	issueInvalidEmail      = "invalid-contact-email"
+	issueInvalidType       = "invalid-event-type"
+	issueMissingStream     = "missing-stream-url"
+	issueInvalidCapacity   = "invalid-capacity"
+	issueInvalidRegistered = "invalid-registered"
+	issueInvalidPrice      = "invalid-price"
+	issueUnknownCurrency   = "unknown-currency"
+	issueInvalidMinAge     = "invalid-min-age"
+)
+
+// eventIssue is a data quality problem of a single event.
+type eventIssue struct {
+	Path  string `json:"path"`
+	Issue string `json:"issue"`
+}
+
+// qualityReport lists the data quality problems of all events.
+type qualityReport struct {
+	Root   string       `json:"root"`
+	Events int          `json:"events"`
+	Issues []eventIssue `json:"issues"`
+}
+
+// validateEvent checks the given event node and its child images for
+// data quality problems.
+func validateEvent(event *service.Node, images []*service.Node,
+	now time.Time) []string {
+	var issues []string
+	start, ok := getTime(event, "events.StartTime")
+	if !ok {
+		issues = append(issues, issueMissingStartTime)
+	}
+	end, hasEnd := getTime(event, "events.EndTime")
+	if ok && hasEnd && end.Before(start) {
+		issues = append(issues, issueEndBeforeStart)
+	}
+	deadline, hasDeadline := getTime(event, "events.RegistrationDeadline")
+	if ok && hasDeadline && deadline.After(start) {
+		issues = append(issues, issueLateDeadline)
+	}
+	if duration := getText(event, "events.Duration"); duration != "" {
+		if _, err := parseDuration(duration); err != nil {
+			issues = append(issues, issueInvalidDuration)
+		}
+		if hasEnd {
+			issues = append(issues, issueEndAndDuration)
+		}
+	}
+	if rule := getText(event, "events.Recurrence"); rule != "" {
+		if _, err := parseRecurrence(rule); err != nil {
+			issues = append(issues, issueInvalidRecurrence)
+		}
+	}
+	switch strings.ToLower(getText(event, "events.Status")) {
+	case "", statusScheduled, statusCancelled, statusPostponed:
+	default:
+		issues = append(issues, issueInvalidStatus)
+	}
+	latitude := strings.TrimSpace(getText(event, "events.Latitude"))
+	longitude := strings.TrimSpace(getText(event, "events.Longitude"))
+	if (latitude == "") != (longitude == "") {
+		issues = append(issues, issueIncompleteGeo)
+	} else if latitude != "" &&
+		!(eventCtx{Node: event}).HasLocation() {
+		issues = append(issues, issueInvalidGeo)
+	}
+	external := strings.TrimSpace(getText(event, "events.ExternalURL"))
+	if external != "" && !validURL(external) {
+		issues = append(issues, issueInvalidURL)
+	}
+	switch strings.ToLower(strings.TrimSpace(
+		getText(event, "events.EventType"))) {
+	case "", typeInPerson:
+	case typeOnline, typeHybrid:
+		if !validURL(strings.TrimSpace(getText(event, "events.StreamURL"))) {
+			issues = append(issues, issueMissingStream)
+		}
+	default:
+		issues = append(issues, issueInvalidType)
+	}
+	email := strings.TrimSpace(getText(event, "events.ContactEmail"))
+	if email != "" && !validEmail(email) {
+		issues = append(issues, issueInvalidEmail)
+	}
+	for _, count := range []struct{ id, issue string }{
+		{"events.Capacity", issueInvalidCapacity},
+		{"events.Registered", issueInvalidRegistered},
+		{"events.MinAge", issueInvalidMinAge},
+	} {
+		if _, ok := getCount(event, count.id); !ok &&
+			strings.TrimSpace(getText(event, count.id)) != "" {
+			issues = append(issues, count.issue)
+		}
+	}
+	if price := strings.TrimSpace(getText(event, "events.Price")); price != "" {
+		if value, err := parsePrice(price); err != nil || value < 0 {
+			issues = append(issues, issueInvalidPrice)
+		}
+	}
+	currency := strings.ToUpper(strings.TrimSpace(
+		getText(event, "events.Currency")))
+	if _, ok := currencySymbols[currency]; currency != "" && !ok {
+		issues = append(issues, issueUnknownCurrency)
+	}
+	if len(images) == 0 {
+		issues = append(issues, issueMissingCover)
+	}
+	if cover := coverPath(event); cover != "" {
+		if image := coverImage(event, images); image == nil ||
+			image.Path != cover {
+			issues = append(issues, issueInvalidCover)
+		}
+	}
+	if strings.TrimSpace(getText(event, "core.Body")) == "" {
+		issues = append(issues, issueEmptyBody)
+	}
+	if ok && getBool(event, "events.Featured") && start.Before(now) {
+		issues = append(issues, issuePastFeatured)
+	}
+	return issues
+}
+
+// rejectedIssues are the issues keeping the module from writing events,
+// see checkEvent. The others, e.g. missing cover images, are reported
+// only.
+var rejectedIssues = map[string]bool{
+	issueEndBeforeStart:    true,
+	issueIncompleteGeo:     true,
+	issueInvalidGeo:        true,
+	issueInvalidURL:        true,
+	issueInvalidCapacity:   true,
+	issueInvalidRegistered: true,
+	issueInvalidPrice:      true,
+	issueUnknownCurrency:   true,
+	issueLateDeadline:      true,
+	issueInvalidType:       true,
+	issueMissingStream:     true,
+	issueInvalidMinAge:     true,
+	issueInvalidCover:      true,
+}
+
+// checkEvent returns the issues of the given event node with the given
+// child images which keep it from being written, see rejectedIssues.
+// Monsti offers no hook to validate the node forms of its editor, so
+// events saved there are only checked by the report.
+func checkEvent(event *service.Node, images []*service.Node) []string {
+	var ret []string
+	for _, issue := range validateEvent(event, images, time.Now()) {
+		if rejectedIssues[issue] {
+			ret = append(ret, issue)
+		}
+	}
+	return ret
+}
+
+// getReportContext checks all events of the list at the given root path
+// visible to the request for data quality problems and returns the
+// report as JSON. Only editors may see the report.
+func getReportContext(req *service.Request, s *service.Session,
+	root string) (
+	map[string][]byte, *service.CacheMods, error) {
+	if !isEditor(req) {
+		return nil, nil, forbidden("Only editors may see the report")
+	}
+	events, sources, missing, err := getSourceEvents(req, s.Monsti(), root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if missing {
+		return nil, nil, notFound("No event list at %q", root)
+	}
+	events = visibleEvents(req, events)
+	report := qualityReport{
+		Root:   root,
+		Events: len(events),
+		Issues: []eventIssue{},
+	}
+	now := time.Now()
+	for _, event := range events {
+		images, err := getImages(s.Monsti(), req.Site, event.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, issue := range validateEvent(event, images, now) {
+			report.Issues = append(report.Issues,
+				eventIssue{Path: event.Path, Issue: issue})
+		}
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not encode report: %v", err)
+	}
+	// Missing cover images are reported. The report must not be served
+	// from the cache to visitors who aren't editors.
+	mods := &service.CacheMods{
+		Deps:   sourceDeps(root, sources, descendImages),
+		Expire: time.Now(),
+	}
+	return rawResponse(body, "application/json"), mods, nil
+}
@@ -0,0 +1,149 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestValidateEvent(t *testing.T) {
+	now := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	text := func(value string) *service.TextField {
+		field := service.TextField(value)
+		return &field
+	}
+	yes := service.BoolField(true)
+	image := &service.Node{Path: "/events/foo/image"}
+	tests := []struct {
+		Fields map[string]service.Field
+		Images []*service.Node
+		Issues []string
+	}{
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{now.Add(time.Hour)},
+			"core.Body":        text("<p>Hello</p>")},
+			[]*service.Node{image}, nil},
+		{map[string]service.Field{"core.Body": text(" ")}, nil,
+			[]string{issueMissingStartTime, issueMissingCover, issueEmptyBody}},
+		{map[string]service.Field{
+			"events.StartTime": &service.DateTimeField{now},
+			"events.EndTime":   &service.DateTimeField{now.Add(-time.Hour)},
+			"events.Duration":  text("2 hours"),
+			"events.Featured":  &yes,
+			"core.Body":        text("Hello")},
+			[]*service.Node{image},
+			[]string{issueEndBeforeStart, issueInvalidDuration,
+				issueEndAndDuration}},
+		{map[string]service.Field{
+			"events.StartTime":  &service.DateTimeField{now.Add(-time.Hour)},
+			"events.Featured":   &yes,
+			"events.CoverImage": text("missing"),
+			"events.Status":     text("delayed"),
+			"events.Latitude":   text("52.5"),
+			"core.Body":         text("Hello")},
+			[]*service.Node{image},
+			[]string{issueInvalidStatus, issueIncompleteGeo, issueInvalidCover,
+				issuePastFeatured}},
+		{map[string]service.Field{
+			"events.StartTime":    &service.DateTimeField{now.Add(time.Hour)},
+			"events.ExternalURL":  text("example.com"),
+			"events.ContactEmail": text("nobody"),
+			"events.EventType":    text("online"),
+			"events.Capacity":     text("-1"),
+			"events.Price":        text("free"),
+			"events.Currency":     text("XYZ"),
+			"core.Body":           text("Hello")},
+			[]*service.Node{image},
+			[]string{issueInvalidURL, issueMissingStream, issueInvalidEmail,
+				issueInvalidCapacity, issueInvalidPrice, issueUnknownCurrency}},
+	}
+	for i, test := range tests {
+		event := &service.Node{Path: "/events/foo", Fields: test.Fields}
+		issues := validateEvent(event, test.Images, now)
+		if !reflect.DeepEqual(issues, test.Issues) {
+			t.Errorf("%d: validateEvent() = %v, should be %v", i, issues,
+				test.Issues)
+		}
+	}
+}
+
+func TestCheckEvent(t *testing.T) {
+	now := time.Now()
+	text := func(value string) *service.TextField {
+		field := service.TextField(value)
+		return &field
+	}
+	start := &service.DateTimeField{now.Add(time.Hour)}
+	tests := []struct {
+		Fields map[string]service.Field
+		Issues []string
+	}{
+		// Incomplete events are reported, but may be saved.
+		{map[string]service.Field{"events.StartTime": start}, nil},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.EndTime": start}, nil},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.EndTime": &service.DateTimeField{now},
+			"core.Body":      text(" ")},
+			[]string{issueEndBeforeStart}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Latitude": text("52.5")},
+			[]string{issueIncompleteGeo}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Latitude": text("95"), "events.Longitude": text("13.4")},
+			[]string{issueInvalidGeo}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.ExternalURL": text("example.com")},
+			[]string{issueInvalidURL}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Capacity": text("-1"), "events.Registered": text("many")},
+			[]string{issueInvalidCapacity, issueInvalidRegistered}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.Price": text("-5"), "events.Currency": text("XYZ")},
+			[]string{issueInvalidPrice, issueUnknownCurrency}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.RegistrationDeadline": &service.DateTimeField{
+				now.Add(2 * time.Hour)}},
+			[]string{issueLateDeadline}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.EventType": text("hybrid")},
+			[]string{issueMissingStream}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.EventType": text("in-person")}, nil},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.EventType": text("outdoor")},
+			[]string{issueInvalidType}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.MinAge": text("-3")},
+			[]string{issueInvalidMinAge}},
+		{map[string]service.Field{"events.StartTime": start,
+			"events.CoverImage": text("missing")},
+			[]string{issueInvalidCover}},
+	}
+	for i, test := range tests {
+		event := &service.Node{Path: "/events/foo", Fields: test.Fields}
+		if issues := checkEvent(event, nil); !reflect.DeepEqual(issues,
+			test.Issues) {
+			t.Errorf("%d: checkEvent() = %v, should be %v", i, issues,
+				test.Issues)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// allowedTags matches escaped bold and closing link tags.
+	allowedTags = regexp.MustCompile(`&lt;(/?(?:b|strong)|/a)&gt;`)
+	// allowedLinks matches escaped opening link tags with an http(s) or
+	// mailto target.
+	allowedLinks = regexp.MustCompile(
+		`&lt;a href=&#34;((?:https?://|mailto:)(?:[^&<>]|&amp;)*)&#34;&gt;`)
+	// anyTag matches any HTML tag.
+	anyTag = regexp.MustCompile(`<[^>]*>`)
+)
+
+// sanitizeHTML escapes the given text except for links and bold text.
+func sanitizeHTML(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = allowedLinks.ReplaceAllString(escaped, `<a href="$1">`)
+	return allowedTags.ReplaceAllString(escaped, `<$1>`)
+}
+
+// stripHTML removes all tags from the given HTML and returns the plain
+// text.
+func stripHTML(text string) string {
+	text = anyTag.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// obfuscate encodes every character of the given text as an HTML
+// character reference, which browsers display as usual but simple
+// address harvesters don't recognize.
+func obfuscate(text string) string {
+	var buf bytes.Buffer
+	for _, r := range text {
+		fmt.Fprintf(&buf, "&#%d;", r)
+	}
+	return buf.String()
+}
+
+// renderPlace returns the HTML of the given place. Unless the site
+// allows limited HTML in places, the place is rendered as plain text.
+func renderPlace(site, place string) []byte {
+	if getSiteSettings(site).PlaceHTML {
+		return []byte(sanitizeHTML(place))
+	}
+	return []byte(html.EscapeString(place))
+}
@@ -0,0 +1,99 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		In, Out string
+	}{
+		{"Town Hall", "Town Hall"},
+		{"Town & Country", "Town &amp; Country"},
+		{"<b>Town</b> Hall", "<b>Town</b> Hall"},
+		{"<strong>Town</strong>", "<strong>Town</strong>"},
+		{`<a href="https://example.com/?a=1&b=2">Hall</a>`,
+			`<a href="https://example.com/?a=1&amp;b=2">Hall</a>`},
+		{`<a href="mailto:hall@example.com">Hall</a>`,
+			`<a href="mailto:hall@example.com">Hall</a>`},
+		{`<a href="javascript:alert(1)">Hall</a>`,
+			`&lt;a href=&#34;javascript:alert(1)&#34;&gt;Hall</a>`},
+		{`<a href="https://example.com" onclick="x()">Hall</a>`,
+			`&lt;a href=&#34;https://example.com&#34; onclick=&#34;x()&#34;&gt;` +
+				`Hall</a>`},
+		{"<script>alert(1)</script>",
+			"&lt;script&gt;alert(1)&lt;/script&gt;"},
+	}
+	for _, test := range tests {
+		if out := sanitizeHTML(test.In); out != test.Out {
+			t.Errorf("sanitizeHTML(%q) = %q, should be %q", test.In, out,
+				test.Out)
+		}
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		In, Out string
+	}{
+		{"Town Hall", "Town Hall"},
+		{` <a href="/hall"><b>Town</b> Hall</a> `, "Town Hall"},
+		{"Town &amp; Country", "Town & Country"},
+	}
+	for _, test := range tests {
+		if out := stripHTML(test.In); out != test.Out {
+			t.Errorf("stripHTML(%q) = %q, should be %q", test.In, out, test.Out)
+		}
+	}
+}
+
+func TestRenderPlace(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{"html": {PlaceHTML: true}}
+	defer func() { moduleConfig.Sites = nil }()
+	place := `<a href="https://example.com/hall"><b>Town</b> Hall</a>`
+	tests := []struct {
+		Site, Out string
+	}{
+		{"example", "&lt;a href=&#34;https://example.com/hall&#34;&gt;" +
+			"&lt;b&gt;Town&lt;/b&gt; Hall&lt;/a&gt;"},
+		{"html", place},
+	}
+	for _, test := range tests {
+		if out := string(renderPlace(test.Site, place)); out != test.Out {
+			t.Errorf("renderPlace(%q, %q) = %q, should be %q", test.Site, place,
+				out, test.Out)
+		}
+	}
+	field := service.TextField(place)
+	event := eventCtx{Node: testEvent("/events/foo",
+		time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)), location: time.UTC}
+	event.Fields["events.Place"] = &field
+	out := string(renderICal("html", 0, []eventCtx{event}))
+	if !strings.Contains(out, "LOCATION:Town Hall\r\n") {
+		t.Errorf("feed lacks plain text location:\n%v", out)
+	}
+	json := toJSONEvents("html", []eventCtx{event}, contentHTML)
+	if json[0].Place != "Town Hall" {
+		t.Errorf("JSON place is %q, should be %q", json[0].Place, "Town Hall")
+	}
+}
@@ -0,0 +1,251 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+	"pkg.monsti.org/monsti/api/util/settings"
+)
+
+// siteSettings contains the configuration of the module for a single
+// site.
+type siteSettings struct {
+	// PlaceHTML allows links and bold text in the events.Place field.
+	PlaceHTML bool
+	// Timezone is the IANA name of the site's time zone, e.g.
+	// "Europe/Berlin". Defaults to the server's local time zone.
+	Timezone string
+	// location is the time zone given by Timezone.
+	location *time.Location
+	// BaseURL is the absolute URL of the site, e.g.
+	// "https://example.com". Defaults to "http://" followed by the site
+	// name.
+	BaseURL string
+	// Root is the path of an events list of the site. It is only used to
+	// check the module's health, as lists show their own children.
+	Root string
+	// UnpinPastEvents lists pinned events as usual once they are over.
+	UnpinPastEvents bool
+	// DefaultLimit is the number of upcoming and of past events shown if
+	// the request does not ask for a limit. Unlimited if zero.
+	DefaultLimit int
+	// MaxLimit caps the limit requested by visitors. No cap if zero.
+	MaxLimit int
+	// Organizer is the organizer of events without one of their own.
+	// Defaults to the site name.
+	Organizer string
+	// Roles maps role names to the logins of the users having the role.
+	// Events requiring a role are only shown to these users.
+	Roles map[string][]string
+	// EditorRole is the role of the users who may see the quality
+	// report of lists and the health of all sites and who may import
+	// events. Nobody may if empty.
+	EditorRole string
+	// PastRetentionDays hides past events which ended more than this
+	// number of days ago. No events are hidden if zero.
+	PastRetentionDays int
+	// FirstDayOfWeek is the first day of calendar weeks, either
+	// "Monday" or "Sunday". Defaults to Monday.
+	FirstDayOfWeek string
+	// CalendarDayLimit is the number of events shown in a day of the
+	// calendar. Further events are linked to by the day. Unlimited if
+	// zero.
+	CalendarDayLimit int
+	// Locale is the locale used to format the site's events if the
+	// request does not specify one. Defaults to the first of the
+	// module's locales.
+	Locale string
+	// FeedLocale is the locale of the titles and bodies of events in
+	// feeds unless the request asks for one by the lang parameter.
+	// Defaults to Locale, feeds don't depend on the subscriber's locale.
+	FeedLocale string
+	// ExcerptLength is the length in characters of the event excerpts
+	// shown in lists, including the ellipsis and the read more suffix.
+	// Defaults to 160.
+	ExcerptLength int
+	// Ellipses maps locales to the ellipsis of shortened excerpts,
+	// overriding the default of the locale, e.g. "…" for English.
+	Ellipses map[string]string
+	// ReadMore maps locales to the text of the link following excerpts,
+	// e.g. "Read more". Excerpts are not followed by a link by default.
+	ReadMore map[string]string
+	// ShareTargets are the share links of event pages, any of
+	// "mastodon", "facebook" and "email". Defaults to all of them, an
+	// empty list disables sharing.
+	ShareTargets []string
+	// MastodonInstance is the host name of the Mastodon instance shared
+	// to. Defaults to "mastodon.social".
+	MastodonInstance string
+	// StartsSoonHours is the number of hours before their start during
+	// which events are marked as starting soon. Defaults to 24.
+	StartsSoonHours int
+	// HideCancelled leaves cancelled events out of the HTML lists and
+	// calendars. Feeds and exports always include them with their status,
+	// so subscribers learn about the cancellation.
+	HideCancelled bool
+}
+
+// moduleSettings contains the configuration of the module as read from
+// the events.yaml configuration file.
+type moduleSettings struct {
+	// Locales are the locales of the sites, which the node types are
+	// translated to. Defaults to German and English.
+	Locales []string
+	// Sites maps site names to their configuration.
+	Sites map[string]siteSettings
+}
+
+// moduleConfig is the configuration loaded during setup.
+var moduleConfig moduleSettings
+
+// loadSettings loads the module's configuration using the given Monsti
+// settings.
+func loadSettings(m *settings.Monsti) error {
+	err := settings.LoadModuleSettings("events", m.Directories.Config,
+		&moduleConfig)
+	if err != nil {
+		return err
+	}
+	if len(moduleConfig.Locales) > 0 {
+		availableLocales = moduleConfig.Locales
+	}
+	for name, site := range moduleConfig.Sites {
+		if site.Locale != "" && !hasLocale(site.Locale) {
+			availableLocales = append(availableLocales, site.Locale)
+		}
+		if site.Timezone == "" {
+			continue
+		}
+		site.location, err = time.LoadLocation(site.Timezone)
+		if err != nil {
+			return fmt.Errorf("Invalid timezone of site %q: %v", name, err)
+		}
+		moduleConfig.Sites[name] = site
+	}
+	return nil
+}
+
+// hasLocale checks if the given locale is one of the available locales.
+func hasLocale(locale string) bool {
+	for _, available := range availableLocales {
+		if available == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// requestLocale returns the locale of the given request, falling back to
+// the site's and then the module's default locale.
+func requestLocale(req *service.Request) string {
+	if req.Session != nil && req.Session.Locale != "" {
+		return req.Session.Locale
+	}
+	if locale := getSiteSettings(req.Site).Locale; locale != "" {
+		return locale
+	}
+	return availableLocales[0]
+}
+
+// feedLocale returns the locale of the feeds of the given site given the
+// value of the lang parameter. Unavailable locales fall back to the
+// site's feed locale and then to its default locale.
+func feedLocale(site, lang string) string {
+	config := getSiteSettings(site)
+	for _, locale := range []string{lang, config.FeedLocale, config.Locale} {
+		for _, available := range availableLocales {
+			if locale != "" && locale == available {
+				return locale
+			}
+		}
+	}
+	return availableLocales[0]
+}
+
+// getSiteSettings returns the configuration of the given site.
+func getSiteSettings(site string) siteSettings {
+	return moduleConfig.Sites[site]
+}
+
+// siteLocation returns the time zone of the given site.
+func siteLocation(site string) *time.Location {
+	if location := getSiteSettings(site).location; location != nil {
+		return location
+	}
+	return time.Local
+}
+
+// eventOrganizer returns the organizer of the given event of the given
+// site, falling back to the site's default organizer.
+func eventOrganizer(site string, event eventCtx) string {
+	if organizer := event.Organizer(); organizer != "" {
+		return organizer
+	}
+	if organizer := getSiteSettings(site).Organizer; organizer != "" {
+		return organizer
+	}
+	return site
+}
+
+// hasRole checks if the user of the given request has the given role on
+// the request's site. Everybody has the empty role.
+func hasRole(req *service.Request, role string) bool {
+	if role == "" {
+		return true
+	}
+	if !authenticated(req) {
+		return false
+	}
+	for _, login := range getSiteSettings(req.Site).Roles[role] {
+		if login == req.Session.User.Login {
+			return true
+		}
+	}
+	return false
+}
+
+// isEditor checks if the user of the given request has the site's
+// editor role. Nobody is an editor if the site does not configure the
+// role.
+func isEditor(req *service.Request) bool {
+	role := getSiteSettings(req.Site).EditorRole
+	return role != "" && hasRole(req, role)
+}
+
+// webcalURL returns the given absolute http or https URL with the webcal
+// scheme used to subscribe to calendars.
+func webcalURL(u string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		if strings.HasPrefix(u, scheme) {
+			return "webcal://" + strings.TrimPrefix(u, scheme)
+		}
+	}
+	return u
+}
+
+// siteURL returns the absolute URL of the given path of the given site.
+func siteURL(site, path string) string {
+	base := getSiteSettings(site).BaseURL
+	if base == "" {
+		base = "http://" + site
+	}
+	return strings.TrimRight(base, "/") + path
+}
@@ -0,0 +1,84 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Share targets of event pages.
+const (
+	shareMastodon = "mastodon"
+	shareFacebook = "facebook"
+	shareEmail    = "email"
+)
+
+// defaultShareTargets are the share targets of sites not configuring
+// their own.
+var defaultShareTargets = []string{shareMastodon, shareFacebook,
+	shareEmail}
+
+// shareLink is a link sharing an event.
+type shareLink struct {
+	// Target is the share target, e.g. shareMastodon.
+	Target string
+	// Label is the English name of the target, which templates translate
+	// for the request's locale.
+	Label string
+	URL   string
+}
+
+// mailtoEscape escapes the given text for mailto URLs, whose clients
+// don't decode plus signs to spaces.
+func mailtoEscape(text string) string {
+	return strings.Replace(url.QueryEscape(text), "+", "%20", -1)
+}
+
+// shareLinks returns the links sharing the given event of the given
+// site for the site's share targets. Unknown targets are ignored.
+func shareLinks(site string, event eventCtx) []shareLink {
+	config := getSiteSettings(site)
+	targets := config.ShareTargets
+	if targets == nil {
+		targets = defaultShareTargets
+	}
+	instance := config.MastodonInstance
+	if instance == "" {
+		instance = "mastodon.social"
+	}
+	title := stripHTML(getText(event.Node, "core.Title"))
+	link := siteURL(site, event.Path+"/")
+	var links []shareLink
+	for _, target := range targets {
+		switch target {
+		case shareMastodon:
+			links = append(links, shareLink{target, "Mastodon",
+				"https://" + instance + "/share?text=" +
+					url.QueryEscape(title+" "+link)})
+		case shareFacebook:
+			links = append(links, shareLink{target, "Facebook",
+				"https://www.facebook.com/sharer/sharer.php?u=" +
+					url.QueryEscape(link)})
+		case shareEmail:
+			links = append(links, shareLink{target, "Email",
+				"mailto:?subject=" + mailtoEscape(title) + "&body=" +
+					mailtoEscape(link)})
+		}
+	}
+	return links
+}
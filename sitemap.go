@@ -0,0 +1,90 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// Sitemap priorities of events.
+const (
+	sitemapPriorityUpcoming = "0.8"
+	sitemapPriorityPast     = "0.3"
+)
+
+// sitemapURL is an entry of a sitemap.
+type sitemapURL struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod,omitempty"`
+	Priority string `xml:"priority"`
+}
+
+// sitemapURLSet is a sitemap as defined by sitemaps.org.
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// getSitemapContext returns a sitemap of the events of the list at the
+// given root path which are visible to the request. Upcoming and ongoing
+// events get a higher priority than past ones.
+func getSitemapContext(req *service.Request, s *service.Session,
+	root string) (map[string][]byte, *service.CacheMods, error) {
+	events, sources, missing, err := getSourceEvents(req, s.Monsti(), root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if missing {
+		return nil, nil, notFound("No event list at %q", root)
+	}
+	location := siteLocation(req.Site)
+	sitemap := sitemapURLSet{URLs: []sitemapURL{}}
+	var upcoming []eventCtx
+	for _, node := range visibleEvents(req, events) {
+		event := eventCtx{Node: node, location: location}
+		entry := sitemapURL{
+			Loc:      siteURL(req.Site, event.Path+"/"),
+			Priority: sitemapPriorityPast,
+		}
+		if changed := event.LastModified(); changed != nil {
+			entry.LastMod = changed.UTC().Format(time.RFC3339)
+		}
+		if event.Upcoming() {
+			entry.Priority = sitemapPriorityUpcoming
+			upcoming = append(upcoming, event)
+		}
+		sitemap.URLs = append(sitemap.URLs, entry)
+	}
+	out, err := xml.MarshalIndent(sitemap, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not encode sitemap: %v", err)
+	}
+	// Priorities change once upcoming events are over, entries when
+	// their visibility window opens or closes.
+	mods := &service.CacheMods{
+		Deps: sourceDeps(root, sources, descendEvents),
+		Expire: earliest(nextTransition(time.Now(), upcoming),
+			visibilityChange(events, time.Now())),
+	}
+	expireIfSessionDependent(mods, events)
+	return rawResponse(append([]byte(xml.Header), out...),
+		"application/xml; charset=utf-8"), mods, nil
+}
@@ -0,0 +1,126 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// nodeReader reads the nodes of sites. It is implemented by the client
+// of the Monsti service.
+type nodeReader interface {
+	GetNode(site, path string) (*service.Node, error)
+	GetChildren(site, path string) ([]*service.Node, error)
+}
+
+// sourcePaths returns the paths of the nodes whose children are listed
+// by the given event list. Sources are separated by commas or white
+// space, relative ones are resolved against the list itself. Without
+// configured sources, the list shows its own children.
+func sourcePaths(list *service.Node) []string {
+	separator := func(r rune) bool {
+		return r == ',' || strings.ContainsRune(" \t\r\n", r)
+	}
+	var sources []string
+	seen := make(map[string]bool)
+	for _, source := range strings.FieldsFunc(
+		getText(list, "events.Sources"), separator) {
+		if !strings.HasPrefix(source, "/") {
+			source = path.Join(list.Path, source)
+		}
+		if source = path.Clean(source); !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		sources = []string{list.Path}
+	}
+	return sources
+}
+
+// getSourceEvents fetches the children of all sources of the event list
+// at the given root path. Events found in several sources are returned
+// once. Missing sources are logged and skipped; missing is only set if
+// the root itself does not exist.
+func getSourceEvents(req *service.Request, m nodeReader,
+	root string) (events []*service.Node, sources []string, missing bool,
+	err error) {
+	list, err := m.GetNode(req.Site, root)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("Could not fetch event list: %v",
+			err)
+	}
+	if list == nil {
+		return nil, []string{root}, true, nil
+	}
+	sources = sourcePaths(list)
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		children, err := m.GetChildren(req.Site, source)
+		if err != nil {
+			// A source pointing to a removed node should not break the
+			// whole list.
+			if node, nodeErr := m.GetNode(req.Site, source); nodeErr == nil &&
+				node == nil {
+				logger.Printf("Skipping missing source %q of event list %q "+
+					"on site %q", source, root, req.Site)
+				continue
+			}
+			return nil, nil, false, fmt.Errorf("Could not fetch children: %v",
+				err)
+		}
+		for _, child := range children {
+			if !seen[child.Path] {
+				seen[child.Path] = true
+				events = append(events, child)
+			}
+		}
+	}
+	return events, sources, false, nil
+}
+
+// Depths of the cache dependencies on the sources of event lists.
+const (
+	// descendEvents covers the events, which are the children of the
+	// sources.
+	descendEvents = 1
+	// descendImages also covers the images of the events, which are
+	// their children.
+	descendImages = 2
+)
+
+// sourceDeps returns cache dependencies on the event list at the given
+// root path and on all of its sources. Sources are descended to the
+// given depth, the list itself only if it is one of its sources, as
+// otherwise just its Sources field is read.
+func sourceDeps(root string, sources []string,
+	descend int) []service.CacheDep {
+	deps := []service.CacheDep{{Node: root}}
+	for _, source := range sources {
+		if source == root {
+			deps[0].Descend = descend
+		} else {
+			deps = append(deps, service.CacheDep{Node: source, Descend: descend})
+		}
+	}
+	return deps
+}
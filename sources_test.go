@@ -0,0 +1,282 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+// testReader is a nodeStore serving the given nodes. It records the
+// paths whose children are fetched.
+type testReader struct {
+	// Nodes are the nodes of the site by path.
+	Nodes map[string]*service.Node
+	// Failing are the paths whose nodes can't be read.
+	Failing map[string]bool
+	// Fetched are the paths whose children have been fetched.
+	Fetched []string
+	// Signals are the names of the emitted signals and their arguments.
+	Signals []testSignal
+}
+
+// testSignal is a signal emitted to a testReader.
+type testSignal struct {
+	Name string
+	Args interface{}
+}
+
+func (r *testReader) GetNode(site, path string) (*service.Node, error) {
+	if r.Failing[path] {
+		return nil, errors.New("backend down")
+	}
+	return r.Nodes[path], nil
+}
+
+func (r *testReader) GetChildren(site, parent string) ([]*service.Node,
+	error) {
+	r.Fetched = append(r.Fetched, parent)
+	if r.Failing[parent] || r.Nodes[parent] == nil {
+		return nil, errors.New("node not found")
+	}
+	var children []*service.Node
+	for nodePath, node := range r.Nodes {
+		if nodePath != "/" && path.Dir(nodePath) == parent {
+			children = append(children, node)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path < children[j].Path
+	})
+	return children, nil
+}
+
+func (r *testReader) WriteNode(site, path string, node *service.Node) error {
+	r.Nodes[path] = node
+	return nil
+}
+
+func (r *testReader) EmitSignal(name string, args interface{},
+	ret interface{}) error {
+	r.Signals = append(r.Signals, testSignal{name, args})
+	return nil
+}
+
+// newTestReader returns a reader serving the given nodes.
+func newTestReader(nodes ...*service.Node) *testReader {
+	ret := &testReader{Nodes: make(map[string]*service.Node),
+		Failing: make(map[string]bool)}
+	for _, node := range nodes {
+		ret.Nodes[node.Path] = node
+	}
+	return ret
+}
+
+func TestGetEventsMissingRoot(t *testing.T) {
+	req := &service.Request{Site: "example"}
+	reader := newTestReader()
+	list, err := getEvents(req, reader, "/events", eventsQuery{Limit: -1})
+	if err != nil {
+		t.Fatalf("getEvents() of missing root failed: %v", err)
+	}
+	if !list.RootMissing || len(list.Ongoing)+len(list.Upcoming)+
+		len(list.Past) != 0 {
+		t.Errorf("getEvents() of missing root = %+v", list)
+	}
+	reader.Failing["/events"] = true
+	if _, err := getEvents(req, reader, "/events",
+		eventsQuery{Limit: -1}); err == nil {
+		t.Errorf("getEvents() should fail if the root can't be read")
+	}
+}
+
+func TestGetSourceEvents(t *testing.T) {
+	sources := service.TextField(". /talks, /removed /talks")
+	list := &service.Node{Path: "/events",
+		Fields: map[string]service.Field{"events.Sources": &sources}}
+	start := time.Now()
+	reader := newTestReader(list, testEvent("/events/a", start),
+		&service.Node{Path: "/talks"}, testEvent("/talks/b", start))
+	req := &service.Request{Site: "example"}
+	var logged bytes.Buffer
+	defer func(original *log.Logger) { logger = original }(logger)
+	logger = log.New(&logged, "", 0)
+	events, paths, missing, err := getSourceEvents(req, reader, "/events")
+	if err != nil || missing {
+		t.Fatalf("getSourceEvents() = %v, %v", missing, err)
+	}
+	if !strings.Contains(logged.String(), `"/removed"`) ||
+		!strings.Contains(logged.String(), `"example"`) {
+		t.Errorf("getSourceEvents() logged %q, should name the missing "+
+			"source and the site", logged.String())
+	}
+	if got := eventPaths(eventCtxs(events)); got != "/events/a /talks/b" {
+		t.Errorf("getSourceEvents() returned %q", got)
+	}
+	if len(paths) != 3 || paths[0] != "/events" || paths[1] != "/talks" ||
+		paths[2] != "/removed" {
+		t.Errorf("getSourceEvents() returned sources %v", paths)
+	}
+	reader.Failing["/talks"] = true
+	if _, _, _, err := getSourceEvents(req, reader, "/events"); err == nil {
+		t.Errorf("getSourceEvents() should fail if a source can't be read")
+	}
+}
+
+// eventCtxs wraps the given event nodes.
+func eventCtxs(events []*service.Node) []eventCtx {
+	ret := make([]eventCtx, len(events))
+	for i, event := range events {
+		ret[i] = eventCtx{Node: event}
+	}
+	return ret
+}
+
+func TestGetEventsFetchesDisplayedImages(t *testing.T) {
+	now := time.Now()
+	reader := newTestReader(&service.Node{Path: "/events"},
+		testEvent("/events/past1", now.Add(-72*time.Hour)),
+		testEvent("/events/past2", now.Add(-48*time.Hour)),
+		testEvent("/events/past3", now.Add(-24*time.Hour)),
+		testEvent("/events/up", now.Add(24*time.Hour)),
+		&service.Node{Path: "/events/past3/image"})
+	req := &service.Request{Site: "example"}
+	tests := []struct {
+		Query   eventsQuery
+		Fetched []string
+	}{
+		{eventsQuery{Limit: 1}, []string{"/events", "/events/past3"}},
+		{eventsQuery{Limit: 1, Offset: 1}, []string{"/events", "/events/past2"}},
+		{eventsQuery{Limit: 1, UpcomingOnly: true}, []string{"/events"}},
+		{eventsQuery{Limit: -1, SkipImages: true}, []string{"/events"}},
+	}
+	for i, test := range tests {
+		reader.Fetched = nil
+		list, err := getEvents(req, reader, "/events", test.Query)
+		if err != nil {
+			t.Fatalf("%d: getEvents() failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(reader.Fetched, test.Fetched) {
+			t.Errorf("%d: getEvents() fetched the children of %v, should be %v",
+				i, reader.Fetched, test.Fetched)
+		}
+		if i == 0 && (len(list.Past) != 1 || len(list.Past[0].Images) != 1) {
+			t.Errorf("%d: past events lack their images: %+v", i, list.Past)
+		}
+	}
+}
+
+func TestSourceDeps(t *testing.T) {
+	tests := []struct {
+		Sources []string
+		Descend int
+		Deps    []service.CacheDep
+	}{
+		{[]string{"/events"}, descendImages,
+			[]service.CacheDep{{Node: "/events", Descend: descendImages}}},
+		{[]string{"/events", "/talks"}, descendEvents,
+			[]service.CacheDep{{Node: "/events", Descend: descendEvents},
+				{Node: "/talks", Descend: descendEvents}}},
+		// Lists not among their sources only depend on their own node.
+		{[]string{"/talks"}, descendImages,
+			[]service.CacheDep{{Node: "/events"},
+				{Node: "/talks", Descend: descendImages}}},
+		{nil, descendImages, []service.CacheDep{{Node: "/events"}}},
+	}
+	for _, test := range tests {
+		deps := sourceDeps("/events", test.Sources, test.Descend)
+		if !reflect.DeepEqual(deps, test.Deps) {
+			t.Errorf("sourceDeps(%v, %v) = %v, should be %v", test.Sources,
+				test.Descend, deps, test.Deps)
+		}
+	}
+}
+
+func TestBuildEventsDataDeps(t *testing.T) {
+	sources := service.TextField(". /talks")
+	reader := newTestReader(&service.Node{Path: "/events",
+		Fields: map[string]service.Field{"events.Sources": &sources}},
+		&service.Node{Path: "/talks"},
+		testEvent("/talks/a", time.Now().Add(time.Hour)))
+	req := &service.Request{Site: "example"}
+	tests := []struct {
+		Query   url.Values
+		Descend int
+	}{
+		// Lists show the images of past events, feeds don't.
+		{url.Values{}, descendImages},
+		{url.Values{"format": {"ics"}}, descendEvents},
+		{url.Values{"format": {"atom"}}, descendEvents},
+	}
+	for _, test := range tests {
+		_, mods, err := buildEventsData(req, reader, "/events", test.Query)
+		if err != nil {
+			t.Fatalf("buildEventsData(%v) failed: %v", test.Query, err)
+		}
+		deps := []service.CacheDep{{Node: "/events", Descend: test.Descend},
+			{Node: "/talks", Descend: test.Descend}}
+		if !reflect.DeepEqual(mods.Deps, deps) {
+			t.Errorf("buildEventsData(%v) depends on %v, should be %v",
+				test.Query, mods.Deps, deps)
+		}
+	}
+}
+
+func TestBuildEventsDataParams(t *testing.T) {
+	moduleConfig.Sites = map[string]siteSettings{
+		"example": {BaseURL: "https://example.com"}}
+	defer func() { moduleConfig.Sites = nil }()
+	now := time.Now()
+	reader := newTestReader(&service.Node{Path: "/events"},
+		testEvent("/events/a", now.Add(-48*time.Hour)),
+		testEvent("/events/b", now.Add(-24*time.Hour)))
+	req := &service.Request{Site: "example"}
+	first, firstMods, err := buildEventsData(req, reader, "/events",
+		url.Values{"past": {"1"}, "limit": {"1"}})
+	if err != nil {
+		t.Fatalf("buildEventsData() failed: %v", err)
+	}
+	second, secondMods, err := buildEventsData(req, reader, "/events",
+		url.Values{"past": {"1"}, "limit": {"1"}, "page": {"2"}})
+	if err != nil {
+		t.Fatalf("buildEventsData() failed: %v", err)
+	}
+	// The pages differ in content and canonical URL, but are invalidated
+	// together.
+	if eventPaths(first.Past) != "/events/b" ||
+		eventPaths(second.Past) != "/events/a" {
+		t.Errorf("pages show %q and %q, should be %q and %q",
+			eventPaths(first.Past), eventPaths(second.Past), "/events/b",
+			"/events/a")
+	}
+	if first.CanonicalURL == second.CanonicalURL {
+		t.Errorf("both pages have the canonical URL %q", first.CanonicalURL)
+	}
+	if !reflect.DeepEqual(firstMods.Deps, secondMods.Deps) {
+		t.Errorf("pages depend on %v and %v", firstMods.Deps, secondMods.Deps)
+	}
+}
@@ -0,0 +1,67 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "fmt"
+
+// spotsUnits contains the phrases describing the free spots of an event
+// in a single locale. The singular and plural phrases take the number of
+// spots.
+type spotsUnits struct {
+	Spot, Spots, SoldOut string
+}
+
+// spotsPhrases contains the phrases of free spots in the available
+// locales and in English. They are generated during setup, see
+// genSpotsPhrases.
+var spotsPhrases map[string]spotsUnits
+
+// genSpotsPhrases generates spotsPhrases from the translations of the
+// English phrases.
+func genSpotsPhrases() {
+	G := func(in string) string { return in }
+	english := spotsUnits{G("%d spot left"), G("%d spots left"),
+		G("Sold out")}
+	spotsPhrases = map[string]spotsUnits{"en": english}
+	for _, locale := range availableLocales {
+		units := english
+		translatePhrases(locale, &units.Spot, &units.Spots, &units.SoldOut)
+		spotsPhrases[locale] = units
+	}
+}
+
+// FormattedSpotsLeft describes the free spots of the event in the given
+// locale, e.g. "3 spots left" or "Sold out" if the event is full. It is
+// empty if the number of spots is unlimited. Unavailable locales fall
+// back to English.
+func (e eventCtx) FormattedSpotsLeft(locale string) string {
+	phrases, ok := spotsPhrases[locale]
+	if !ok {
+		phrases = spotsPhrases["en"]
+	}
+	if e.IsFull() {
+		return phrases.SoldOut
+	}
+	left := e.SpotsLeft()
+	switch {
+	case left == nil:
+		return ""
+	case *left == 1:
+		return fmt.Sprintf(phrases.Spot, *left)
+	}
+	return fmt.Sprintf(phrases.Spots, *left)
+}
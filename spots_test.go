@@ -0,0 +1,64 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestFormattedSpotsLeft(t *testing.T) {
+	genSpotsPhrases()
+	// The German phrases as translated by the message catalog.
+	spotsPhrases["de"] = spotsUnits{"noch %d Platz frei",
+		"noch %d Plätze frei", "Ausgebucht"}
+	defer genSpotsPhrases()
+	yes := service.BoolField(true)
+	capacity := service.TextField("10")
+	tests := []struct {
+		Registered string
+		SoldOut    bool
+		Unlimited  bool
+		En, De     string
+	}{
+		{"9", false, false, "1 spot left", "noch 1 Platz frei"},
+		{"7", false, false, "3 spots left", "noch 3 Plätze frei"},
+		{"10", false, false, "Sold out", "Ausgebucht"},
+		{"12", false, false, "Sold out", "Ausgebucht"},
+		{"2", true, false, "Sold out", "Ausgebucht"},
+		{"2", false, true, "", ""},
+	}
+	for i, test := range tests {
+		registered := service.TextField(test.Registered)
+		fields := map[string]service.Field{"events.Registered": &registered}
+		if !test.Unlimited {
+			fields["events.Capacity"] = &capacity
+		}
+		if test.SoldOut {
+			fields["events.SoldOut"] = &yes
+		}
+		event := eventCtx{Node: &service.Node{Fields: fields}}
+		for locale, expected := range map[string]string{"en": test.En,
+			"de": test.De, "xx": test.En} {
+			if spots := event.FormattedSpotsLeft(locale); spots != expected {
+				t.Errorf("%d: FormattedSpotsLeft(%q) = %q, should be %q", i,
+					locale, spots, expected)
+			}
+		}
+	}
+}
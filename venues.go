@@ -0,0 +1,64 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// venueGroup contains the events taking place at a single venue. Events
+// without a place are grouped under the empty venue.
+type venueGroup struct {
+	Venue  string
+	Count  int
+	Events []eventCtx
+}
+
+// groupByVenue groups the given events by their place. The groups are
+// sorted by venue name with the empty venue last, the events of each
+// group by start time.
+func groupByVenue(events ...[]eventCtx) []venueGroup {
+	groups := make(map[string]*venueGroup)
+	var venues []string
+	for _, list := range events {
+		for _, event := range list {
+			venue := stripHTML(getText(event.Node, "events.Place"))
+			if _, ok := groups[venue]; !ok {
+				groups[venue] = &venueGroup{Venue: venue}
+				venues = append(venues, venue)
+			}
+			groups[venue].Events = append(groups[venue].Events, event)
+		}
+	}
+	sort.Slice(venues, func(i, j int) bool {
+		if venues[i] == "" || venues[j] == "" {
+			return venues[j] == ""
+		}
+		return strings.ToLower(venues[i]) < strings.ToLower(venues[j])
+	})
+	ret := make([]venueGroup, len(venues))
+	for i, venue := range venues {
+		group := groups[venue]
+		sort.SliceStable(group.Events, func(i, j int) bool {
+			return byStart(group.Events[i].Node, group.Events[j].Node)
+		})
+		group.Count = len(group.Events)
+		ret[i] = *group
+	}
+	return ret
+}
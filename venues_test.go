@@ -0,0 +1,70 @@
+// This file is part of Monsti, a web content management system.
+// Copyright 2015 Christian Neumann
+//
+// Monsti is free software: you can redistribute it and/or modify it under the
+// terms of the GNU Affero General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option) any
+// later version.
+//
+// Monsti is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+// A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with Monsti.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"pkg.monsti.org/monsti/api/service"
+)
+
+func TestGroupByVenue(t *testing.T) {
+	start := time.Date(2015, 6, 1, 18, 0, 0, 0, time.UTC)
+	event := func(path, place string, days int) eventCtx {
+		node := testEvent(path, start.AddDate(0, 0, days))
+		if place != "" {
+			field := service.TextField(place)
+			node.Fields["events.Place"] = &field
+		}
+		return eventCtx{Node: node, location: time.UTC}
+	}
+	upcoming := []eventCtx{
+		event("/late", "Town Hall", 3),
+		event("/tba", "", 1),
+		event("/early", `<a href="/hall">Town Hall</a>`, 2),
+	}
+	past := []eventCtx{
+		event("/old", "Atrium", -1),
+		event("/old-tba", "", -2),
+	}
+	groups := groupByVenue(upcoming, past)
+	expected := []struct {
+		Venue string
+		Paths string
+	}{
+		{"Atrium", "/old"},
+		{"Town Hall", "/early /late"},
+		{"", "/old-tba /tba"},
+	}
+	if len(groups) != len(expected) {
+		t.Fatalf("groupByVenue returned %d groups, should be %d", len(groups),
+			len(expected))
+	}
+	for i, group := range groups {
+		if group.Venue != expected[i].Venue ||
+			eventPaths(group.Events) != expected[i].Paths ||
+			group.Count != len(group.Events) {
+			t.Errorf("group %d is %q with %q (%d), should be %q with %q", i,
+				group.Venue, eventPaths(group.Events), group.Count,
+				expected[i].Venue, expected[i].Paths)
+		}
+	}
+	if groups := groupByVenue(nil, nil); len(groups) != 0 {
+		t.Errorf("groupByVenue without events returned %v", groups)
+	}
+}